@@ -10,12 +10,20 @@ import (
 
 type (
 	Config struct {
-		App   `yaml:"app"`
-		HTTP  `yaml:"http"`
-		Log   `yaml:"logger"`
-		PG    `yaml:"postgres"`
-		Redis `yaml:"redis"`
-		JWT   `yaml:"jwt"`
+		App          `yaml:"app"`
+		HTTP         `yaml:"http"`
+		Metrics      `yaml:"metrics"`
+		Tracing      `yaml:"tracing"`
+		Log          `yaml:"logger"`
+		PG           `yaml:"postgres"`
+		Redis        `yaml:"redis"`
+		LocalCache   `yaml:"local_cache"`
+		Cache        `yaml:"cache"`
+		JWT          `yaml:"jwt"`
+		Registration `yaml:"registration"`
+		OIDC         `yaml:"oidc"`
+		Jobs         `yaml:"jobs"`
+		Trash        `yaml:"trash"`
 	}
 
 	App struct {
@@ -27,8 +35,21 @@ type (
 		Port string `env:"HTTP_PORT" env-required:"true" yaml:"port"`
 	}
 
+	Metrics struct {
+		Port string `env:"METRICS_PORT" env-required:"true" yaml:"port"`
+	}
+
+	Tracing struct {
+		// Exporter is one of none, stdout or otlp.
+		Exporter    string  `env:"TRACING_EXPORTER"     env-required:"true" yaml:"exporter"`
+		Endpoint    string  `env:"TRACING_ENDPOINT"                         yaml:"endpoint"`
+		SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" env-required:"true" yaml:"sample_ratio"`
+	}
+
 	Log struct {
-		Level string `env:"LOG_LEVEL" env-required:"true" yaml:"log_level"`
+		Level string `env:"LOG_LEVEL"  env-required:"true" yaml:"log_level"`
+		// Format is console for human-readable lines or json for one JSON object per line.
+		Format string `env:"LOG_FORMAT" env-required:"true" yaml:"format"`
 	}
 
 	PG struct {
@@ -37,13 +58,72 @@ type (
 	}
 
 	Redis struct {
-		URL string `env:"REDIS_URL" env-required:"true"`
+		URL             string        `env:"REDIS_URL"              env-required:"true"`
+		BreakerFailures int           `env:"REDIS_BREAKER_FAILURES" env-required:"true" yaml:"breaker_failures"`
+		BreakerCooldown time.Duration `env:"REDIS_BREAKER_COOLDOWN" env-required:"true" yaml:"breaker_cooldown"`
+	}
+
+	LocalCache struct {
+		Size int           `env-required:"true" yaml:"size" env:"LOCAL_CACHE_SIZE"`
+		TTL  time.Duration `env-required:"true" yaml:"ttl"  env:"LOCAL_CACHE_TTL"`
+	}
+
+	Cache struct {
+		Enabled          bool          `                    yaml:"enabled"            env:"CACHE_ENABLED"`
+		KeyPrefix        string        `                    yaml:"key_prefix"         env:"CACHE_KEY_PREFIX"`
+		TTL              time.Duration `env-required:"true" yaml:"ttl"                env:"CACHE_TTL"`
+		Jitter           float64       `                    yaml:"jitter"             env:"CACHE_JITTER"`
+		StaleTTL         time.Duration `env-required:"true" yaml:"stale_ttl"          env:"CACHE_STALE_TTL"`
+		EarlyRefreshBeta float64       `env-required:"true" yaml:"early_refresh_beta" env:"CACHE_EARLY_REFRESH_BETA"`
+		NotFoundTTL      time.Duration `env-required:"true" yaml:"not_found_ttl"      env:"CACHE_NOT_FOUND_TTL"`
+		WarmUpOnStart    bool          `                    yaml:"warm_up_on_start"   env:"CACHE_WARM_UP_ON_START"`
+		WarmUpBatchSize  int           `env-required:"true" yaml:"warm_up_batch_size" env:"CACHE_WARM_UP_BATCH_SIZE"`
 	}
 
 	JWT struct {
-		SignKey  string        `env-required:"true"                  env:"JWT_SIGN_KEY"`
-		TokenTTL time.Duration `env-required:"true" yaml:"token_ttl" env:"JWT_TOKEN_TTL"`
-		Salt     string        `env-required:"true" env:"JWT_SALT"`
+		// SignKey encrypts the signing keys stored in the database.
+		SignKey string `env-required:"true" env:"JWT_SIGN_KEY"`
+		// Algorithm is RS256 or EdDSA.
+		Algorithm   string        `env-required:"true" yaml:"algorithm"    env:"JWT_ALGORITHM"`
+		KeyRotation time.Duration `env-required:"true" yaml:"key_rotation" env:"JWT_KEY_ROTATION"`
+		// TokenTTL is the lifetime of access tokens.
+		TokenTTL        time.Duration `env-required:"true" yaml:"token_ttl"         env:"JWT_TOKEN_TTL"`
+		RefreshTokenTTL time.Duration `env-required:"true" yaml:"refresh_token_ttl" env:"JWT_REFRESH_TOKEN_TTL"`
+		Salt            string        `env-required:"true"                          env:"JWT_SALT"`
+		// RevocationFailOpen accepts user tokens while the revocation list in Redis cannot be read.
+		// Admin tokens are rejected then regardless.
+		RevocationFailOpen bool `yaml:"revocation_fail_open" env:"JWT_REVOCATION_FAIL_OPEN"`
+	}
+
+	Registration struct {
+		// Open allows anonymous callers to register accounts with the user role.
+		Open bool `yaml:"open" env:"REGISTRATION_OPEN"`
+		// BootstrapToken lets the first admin be created through /v1/auth/bootstrap. Empty disables it.
+		BootstrapToken string `env:"ADMIN_BOOTSTRAP_TOKEN"`
+	}
+
+	// OIDC configures tokens from an external identity provider. It is disabled when Issuer is empty.
+	OIDC struct {
+		Issuer   string `yaml:"issuer"   env:"OIDC_ISSUER"`
+		Audience string `yaml:"audience" env:"OIDC_AUDIENCE"`
+		// JWKS is the file path or URL of the provider key set.
+		JWKS string `yaml:"jwks" env:"OIDC_JWKS"`
+		// JWKSCacheFile keeps the last fetched key set for when JWKS cannot be reached.
+		JWKSCacheFile   string        `yaml:"jwks_cache_file"   env:"OIDC_JWKS_CACHE_FILE"`
+		JWKSRefresh     time.Duration `yaml:"jwks_refresh"      env:"OIDC_JWKS_REFRESH"      env-default:"1h"`
+		UsernameClaim   string        `yaml:"username_claim"    env:"OIDC_USERNAME_CLAIM"    env-default:"preferred_username"`
+		RoleClaim       string        `yaml:"role_claim"        env:"OIDC_ROLE_CLAIM"`
+		AdminRoleValues []string      `yaml:"admin_role_values" env:"OIDC_ADMIN_ROLE_VALUES" env-separator:","`
+	}
+
+	Jobs struct {
+		PollInterval time.Duration `env-required:"true" yaml:"poll_interval" env:"JOBS_POLL_INTERVAL"`
+		BatchSize    int           `env-required:"true" yaml:"batch_size"    env:"JOBS_BATCH_SIZE"`
+	}
+
+	Trash struct {
+		Retention     time.Duration `env-required:"true" yaml:"retention"      env:"TRASH_RETENTION"`
+		PurgeInterval time.Duration `env-required:"true" yaml:"purge_interval" env:"TRASH_PURGE_INTERVAL"`
 	}
 )
 
@@ -58,5 +138,23 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("error reading config: %w", err)
 	}
 
+	err = cfg.Cache.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache config: %w", err)
+	}
+
 	return cfg, nil
 }
+
+func (c Cache) validate() error {
+	// A jittered TTL must stay positive, or every cached banner would be stale as soon as it is written.
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		return fmt.Errorf("jitter must be at least 0 and less than 1, got %g", c.Jitter)
+	}
+
+	if c.WarmUpBatchSize <= 0 {
+		return fmt.Errorf("warm_up_batch_size must be positive, got %d", c.WarmUpBatchSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestListBannersShowsCurrentVariants(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createBanner(t, token, featureID, []int{tagID}, `{"title":"base"}`,
+		variant{Name: "a", Weight: 1, Content: json.RawMessage(`{"title":"a"}`)})
+
+	status := do(t, http.MethodPatch, fmt.Sprintf("/v1/banner/%d", bannerID), token, map[string]interface{}{
+		"variants": []variant{{Name: "b", Weight: 2, Content: json.RawMessage(`{"title":"b"}`)}},
+	}, nil)
+	expectStatus(t, "update banner", status, http.StatusNoContent)
+
+	banners := listBanners(t, token, "/v1/banner", featureID)
+	if len(banners) != 1 || banners[0].BannerID != bannerID {
+		t.Fatalf("Unexpected banners for feature %d: %+v", featureID, banners)
+	}
+
+	banner := banners[0]
+	if !sameJSON(t, banner.Content, []byte(`{"title":"base"}`)) {
+		t.Errorf("Unexpected content: got %s, want the content of the first version", banner.Content)
+	}
+	if len(banner.Variants) != 1 || banner.Variants[0].Name != "b" || banner.Variants[0].Weight != 2 {
+		t.Errorf("Unexpected variants: got %+v, want only variant b", banner.Variants)
+	}
+}
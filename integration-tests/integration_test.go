@@ -4,11 +4,217 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+const _baseURL = "http://banners:8080"
+
+// The admin the tests act as. It is bootstrapped with ADMIN_BOOTSTRAP_TOKEN on first use.
+const (
+	_adminUsername = "integration_admin"
+	_adminPassword = "integration_password"
+)
+
+// _lastID hands out feature and tag IDs no other test run has used, so tests do not depend on
+// what earlier runs left in the database.
+var _lastID = atomic.Int32{}
+
+func init() {
+	_lastID.Store(int32(time.Now().Unix()%1_000_000) * 1000)
+}
+
+func newID() int {
+	return int(_lastID.Add(1))
+}
+
+// do sends body as JSON with the given token and decodes the JSON response into out when it is not nil.
+// It returns the response status.
+func do(t *testing.T, method, path, token string, body, out interface{}) int {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, _baseURL+path, reqBody)
+	if err != nil {
+		t.Fatalf("Failed to create %s %s request: %v", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send %s %s request: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < http.StatusMultipleChoices {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s %s response: %v", method, path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// expectStatus fails the test when a request did not respond with want.
+func expectStatus(t *testing.T, request string, got, want int) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("Unexpected status code for %s: got %d, want %d", request, got, want)
+	}
+}
+
+func login(t *testing.T, username, password string) string {
+	t.Helper()
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	status := do(t, http.MethodPost, "/v1/auth/login", "", map[string]string{
+		"username": username,
+		"password": password,
+	}, &tokens)
+	expectStatus(t, "login", status, http.StatusOK)
+
+	return tokens.Token
+}
+
+// adminToken logs in as the test admin, creating it with the bootstrap token when no admin exists yet.
+func adminToken(t *testing.T) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]string{"username": _adminUsername, "password": _adminPassword})
+	if err != nil {
+		t.Fatalf("Failed to encode bootstrap request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, _baseURL+"/v1/auth/bootstrap", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create bootstrap request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bootstrap-Token", os.Getenv("ADMIN_BOOTSTRAP_TOKEN"))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send bootstrap request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Unexpected status code for bootstrap: got %d, want %d or %d",
+			resp.StatusCode, http.StatusCreated, http.StatusConflict)
+	}
+
+	return login(t, _adminUsername, _adminPassword)
+}
+
+// userToken registers a new user and logs in as it.
+func userToken(t *testing.T) string {
+	t.Helper()
+
+	username := fmt.Sprintf("testuser_%d", time.Now().UnixNano())
+	status := do(t, http.MethodPost, "/v1/auth/register", "", map[string]string{
+		"username": username,
+		"password": "testpassword",
+		"role":     "user",
+	}, nil)
+	expectStatus(t, "register", status, http.StatusCreated)
+
+	return login(t, username, "testpassword")
+}
+
+type variant struct {
+	Name    string          `json:"name"`
+	Weight  int             `json:"weight"`
+	Content json.RawMessage `json:"content"`
+}
+
+type bannerInfo struct {
+	BannerID      int             `json:"banner_id"`
+	TagIDs        []int           `json:"tag_ids"`
+	FeatureID     int             `json:"feature_id"`
+	Content       json.RawMessage `json:"content"`
+	Variants      []variant       `json:"variants"`
+	IsActive      bool            `json:"is_active"`
+	PinnedVersion *int            `json:"pinned_version"`
+	DeletedBy     *string         `json:"deleted_by"`
+}
+
+// createBanner creates an active banner and returns its ID.
+func createBanner(t *testing.T, token string, featureID int, tagIDs []int, content string, variants ...variant) int {
+	t.Helper()
+
+	var created struct {
+		BannerID int `json:"banner_id"`
+	}
+	status := do(t, http.MethodPost, "/v1/banner", token, map[string]interface{}{
+		"feature_id": featureID,
+		"tag_ids":    tagIDs,
+		"content":    json.RawMessage(content),
+		"variants":   variants,
+		"is_active":  true,
+	}, &created)
+	expectStatus(t, "create banner", status, http.StatusCreated)
+
+	return created.BannerID
+}
+
+// listBanners returns the banners of a feature from the listing, or from the trash when path is
+// /v1/banner/trash.
+func listBanners(t *testing.T, token, path string, featureID int) []bannerInfo {
+	t.Helper()
+
+	var banners []bannerInfo
+	status := do(t, http.MethodGet, fmt.Sprintf("%s?feature_id=%d", path, featureID), token, nil, &banners)
+	expectStatus(t, "GET "+path, status, http.StatusOK)
+
+	return banners
+}
+
+// sameJSON reports whether two JSON documents are equal. Postgres reformats JSONB, so the text may differ.
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("Failed to decode %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("Failed to decode %s: %v", b, err)
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
+
+// userBanner returns the status and, on success, the content a user gets for a feature/tag pair.
+// The cache is bypassed, so the result reflects the last write.
+func userBanner(t *testing.T, token string, featureID, tagID int, query string) (int, string) {
+	t.Helper()
+
+	var content string
+	path := fmt.Sprintf("/v1/user_banner?feature_id=%d&tag_id=%d&use_last_revision=true%s", featureID, tagID, query)
+	status := do(t, http.MethodGet, path, token, nil, &content)
+
+	return status, content
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	resp, err := http.Get("http://banners:8080/health")
 	if err != nil {
@@ -0,0 +1,155 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+// deleteBanner moves a banner to the trash, or removes it for good when hard is set.
+func deleteBanner(t *testing.T, token string, bannerID int, hard bool) {
+	t.Helper()
+
+	status := do(t, http.MethodDelete, fmt.Sprintf("/v1/banner/%d?hard=%t", bannerID, hard), token, nil, nil)
+	expectStatus(t, "delete banner", status, http.StatusNoContent)
+}
+
+func restoreBanner(t *testing.T, token string, bannerID int) int {
+	t.Helper()
+
+	return do(t, http.MethodPost, fmt.Sprintf("/v1/banner/%d/restore", bannerID), token, nil, nil)
+}
+
+func TestTrashListsDeletedBanners(t *testing.T) {
+	token := adminToken(t)
+	featureID := newID()
+
+	kept := createBanner(t, token, featureID, []int{newID()}, `{"title":"kept"}`)
+	deleted := createBanner(t, token, featureID, []int{newID()}, `{"title":"deleted"}`)
+	deleteBanner(t, token, deleted, false)
+
+	banners := listBanners(t, token, "/v1/banner", featureID)
+	if len(banners) != 1 || banners[0].BannerID != kept {
+		t.Errorf("Unexpected banners for feature %d: %+v", featureID, banners)
+	}
+
+	trash := listBanners(t, token, "/v1/banner/trash", featureID)
+	if len(trash) != 1 || trash[0].BannerID != deleted {
+		t.Fatalf("Unexpected trash for feature %d: %+v", featureID, trash)
+	}
+	if trash[0].DeletedBy == nil || *trash[0].DeletedBy != _adminUsername {
+		t.Errorf("Unexpected deleted_by: got %v, want %s", trash[0].DeletedBy, _adminUsername)
+	}
+}
+
+func TestRestoreBannerConflict(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	deleted := createBanner(t, token, featureID, []int{tagID}, `{"title":"deleted"}`)
+	deleteBanner(t, token, deleted, false)
+
+	// The pair is free again once the banner is in the trash, so restoring has to wait for it.
+	replacement := createBanner(t, token, featureID, []int{tagID}, `{"title":"replacement"}`)
+	expectStatus(t, "restore banner over a taken pair", restoreBanner(t, token, deleted), http.StatusConflict)
+
+	deleteBanner(t, token, replacement, false)
+	expectStatus(t, "restore banner", restoreBanner(t, token, deleted), http.StatusNoContent)
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"deleted"}`)
+}
+
+func TestTrashNotFound(t *testing.T) {
+	token := adminToken(t)
+
+	bannerID := createBanner(t, token, newID(), []int{newID()}, `{"title":"a"}`)
+	expectStatus(t, "restore banner outside the trash", restoreBanner(t, token, bannerID), http.StatusNotFound)
+	expectStatus(t, "restore missing banner", restoreBanner(t, token, newID()), http.StatusNotFound)
+
+	deleteBanner(t, token, bannerID, false)
+	status := do(t, http.MethodDelete, fmt.Sprintf("/v1/banner/%d", bannerID), token, nil, nil)
+	expectStatus(t, "delete banner in the trash", status, http.StatusNotFound)
+
+	status = do(t, http.MethodDelete, fmt.Sprintf("/v1/banner/%d", newID()), token, nil, nil)
+	expectStatus(t, "delete missing banner", status, http.StatusNotFound)
+}
+
+func TestPurgeDeletedBanners(t *testing.T) {
+	token := adminToken(t)
+	featureID := newID()
+
+	expired := createBanner(t, token, featureID, []int{newID()}, `{"title":"expired"}`)
+	recent := createBanner(t, token, featureID, []int{newID()}, `{"title":"recent"}`)
+	deleteBanner(t, token, expired, false)
+	deleteBanner(t, token, recent, false)
+
+	pg, err := postgres.New(os.Getenv("PG_URL"))
+	if err != nil {
+		t.Fatalf("Failed to connect to postgres: %v", err)
+	}
+	defer pg.Close()
+
+	ctx := context.Background()
+	_, err = pg.Pool.Exec(ctx, "UPDATE banners SET deleted_at = NOW() - INTERVAL '2 hours' WHERE id = $1", expired)
+	if err != nil {
+		t.Fatalf("Failed to backdate deleted banner: %v", err)
+	}
+
+	l := zerolog.Nop()
+	if _, err := postgresrepo.NewBannerRepo(pg, &l).PurgeDeletedBanners(ctx, time.Hour, 1000); err != nil {
+		t.Fatalf("Failed to purge deleted banners: %v", err)
+	}
+
+	trash := listBanners(t, token, "/v1/banner/trash", featureID)
+	if len(trash) != 1 || trash[0].BannerID != recent {
+		t.Errorf("Unexpected trash after purge: got %+v, want only banner %d", trash, recent)
+	}
+	expectStatus(t, "restore purged banner", restoreBanner(t, token, expired), http.StatusNotFound)
+}
+
+func TestSoftDeletedBannerIsHiddenUntilRestored(t *testing.T) {
+	token, user := adminToken(t), userToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createBanner(t, token, featureID, []int{tagID}, `{"title":"a"}`)
+	expectUserBanner(t, user, featureID, tagID, "", `{"title":"a"}`)
+
+	deleteBanner(t, token, bannerID, false)
+
+	status, _ := userBanner(t, user, featureID, tagID, "")
+	expectStatus(t, "get deleted user banner", status, http.StatusNotFound)
+	if banners := listBanners(t, token, "/v1/banner", featureID); len(banners) != 0 {
+		t.Errorf("Unexpected banners after delete: %+v", banners)
+	}
+
+	expectStatus(t, "restore banner", restoreBanner(t, token, bannerID), http.StatusNoContent)
+
+	expectUserBanner(t, user, featureID, tagID, "", `{"title":"a"}`)
+	if banners := listBanners(t, token, "/v1/banner", featureID); len(banners) != 1 || banners[0].BannerID != bannerID {
+		t.Errorf("Unexpected banners after restore: %+v", banners)
+	}
+}
+
+func TestHardDeleteRemovesVersions(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createVersionedBanner(t, token, featureID, tagID, `{"title":"v1"}`, `{"title":"v2"}`)
+	deleteBanner(t, token, bannerID, true)
+
+	status := do(t, http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions", bannerID), token, nil, nil)
+	expectStatus(t, "get versions of deleted banner", status, http.StatusNotFound)
+	status = do(t, http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions/1", bannerID), token, nil, nil)
+	expectStatus(t, "get version of deleted banner", status, http.StatusNotFound)
+
+	if trash := listBanners(t, token, "/v1/banner/trash", featureID); len(trash) != 0 {
+		t.Errorf("Unexpected trash after hard delete: %+v", trash)
+	}
+	expectStatus(t, "restore hard deleted banner", restoreBanner(t, token, bannerID), http.StatusNotFound)
+}
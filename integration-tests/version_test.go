@@ -0,0 +1,130 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type bannerVersion struct {
+	Version int             `json:"version"`
+	Content json.RawMessage `json:"content"`
+}
+
+// createVersionedBanner creates a banner with one version per content and returns its ID.
+func createVersionedBanner(t *testing.T, token string, featureID, tagID int, contents ...string) int {
+	t.Helper()
+
+	bannerID := createBanner(t, token, featureID, []int{tagID}, contents[0])
+	for _, content := range contents[1:] {
+		status := do(t, http.MethodPatch, fmt.Sprintf("/v1/banner/%d", bannerID), token, map[string]interface{}{
+			"content": json.RawMessage(content),
+		}, nil)
+		expectStatus(t, "update banner", status, http.StatusNoContent)
+	}
+
+	return bannerID
+}
+
+// expectUserBanner checks the content served for a feature/tag pair.
+func expectUserBanner(t *testing.T, token string, featureID, tagID int, query, want string) {
+	t.Helper()
+
+	status, content := userBanner(t, token, featureID, tagID, query)
+	expectStatus(t, "get user banner"+query, status, http.StatusOK)
+	if !sameJSON(t, []byte(content), []byte(want)) {
+		t.Errorf("Unexpected user banner%s: got %s, want %s", query, content, want)
+	}
+}
+
+func TestBannerVersions(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createVersionedBanner(t, token, featureID, tagID, `{"title":"v1"}`, `{"title":"v2"}`)
+
+	var versions []bannerVersion
+	status := do(t, http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions", bannerID), token, nil, &versions)
+	expectStatus(t, "get banner versions", status, http.StatusOK)
+	if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+		t.Fatalf("Unexpected versions: %+v", versions)
+	}
+	if !sameJSON(t, versions[0].Content, []byte(`{"title":"v1"}`)) {
+		t.Errorf("Unexpected content of version 1: %s", versions[0].Content)
+	}
+
+	var version bannerVersion
+	status = do(t, http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions/2", bannerID), token, nil, &version)
+	expectStatus(t, "get banner version 2", status, http.StatusOK)
+	if version.Version != 2 || !sameJSON(t, version.Content, []byte(`{"title":"v2"}`)) {
+		t.Errorf("Unexpected version 2: %+v", version)
+	}
+
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"v2"}`)
+	expectUserBanner(t, token, featureID, tagID, "&version=1", `{"title":"v1"}`)
+}
+
+func TestBannerVersionsNotFound(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createVersionedBanner(t, token, featureID, tagID, `{"title":"v1"}`)
+	missingBannerID := newID()
+
+	for _, request := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions", missingBannerID)},
+		{http.MethodGet, fmt.Sprintf("/v1/banner/%d/versions/2", bannerID)},
+		{http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/2/rollback", bannerID)},
+		{http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/1/rollback", missingBannerID)},
+		{http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/2/pin", bannerID)},
+	} {
+		status := do(t, request.method, request.path, token, nil, nil)
+		expectStatus(t, request.method+" "+request.path, status, http.StatusNotFound)
+	}
+
+	status, _ := userBanner(t, token, featureID, tagID, "&version=2")
+	expectStatus(t, "get missing user banner version", status, http.StatusNotFound)
+}
+
+func TestUserBannerVersionIsAdminOnly(t *testing.T) {
+	featureID, tagID := newID(), newID()
+	createVersionedBanner(t, adminToken(t), featureID, tagID, `{"title":"v1"}`, `{"title":"v2"}`)
+
+	status, _ := userBanner(t, userToken(t), featureID, tagID, "&version=1")
+	expectStatus(t, "get user banner version as user", status, http.StatusForbidden)
+}
+
+func TestRollbackBanner(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createVersionedBanner(t, token, featureID, tagID, `{"title":"v1"}`, `{"title":"v2"}`)
+
+	status := do(t, http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/1/rollback", bannerID), token, nil, nil)
+	expectStatus(t, "rollback banner", status, http.StatusNoContent)
+
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"v1"}`)
+}
+
+func TestRollbackPinnedBanner(t *testing.T) {
+	token := adminToken(t)
+	featureID, tagID := newID(), newID()
+
+	bannerID := createVersionedBanner(t, token, featureID, tagID, `{"title":"v1"}`, `{"title":"v2"}`, `{"title":"v3"}`)
+
+	status := do(t, http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/2/pin", bannerID), token, nil, nil)
+	expectStatus(t, "pin banner version", status, http.StatusNoContent)
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"v2"}`)
+
+	// The pinned version is still served after a rollback, until it is unpinned.
+	status = do(t, http.MethodPost, fmt.Sprintf("/v1/banner/%d/versions/1/rollback", bannerID), token, nil, nil)
+	expectStatus(t, "rollback banner", status, http.StatusNoContent)
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"v2"}`)
+
+	status = do(t, http.MethodDelete, fmt.Sprintf("/v1/banner/%d/pin", bannerID), token, nil, nil)
+	expectStatus(t, "unpin banner version", status, http.StatusNoContent)
+	expectUserBanner(t, token, featureID, tagID, "", `{"title":"v1"}`)
+}
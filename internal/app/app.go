@@ -1,19 +1,24 @@
 package app
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/realPointer/banners/config"
 	v1 "github.com/realPointer/banners/internal/controller/http/v1"
 	"github.com/realPointer/banners/internal/repository"
 	"github.com/realPointer/banners/internal/service"
 	"github.com/realPointer/banners/pkg/httpserver"
+	"github.com/realPointer/banners/pkg/jwks"
 	"github.com/realPointer/banners/pkg/logger"
 	"github.com/realPointer/banners/pkg/postgres"
 	"github.com/realPointer/banners/pkg/redis"
+	"github.com/realPointer/banners/pkg/tracing"
 )
 
 func Run() {
@@ -24,11 +29,27 @@ func Run() {
 	}
 
 	// Logger
-	l, err := logger.New(cfg.Log.Level)
+	l, err := logger.New(cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
 		log.Fatalf("Logger error: %s", err)
 	}
 
+	// Tracing
+	tracer, err := tracing.New(cfg.Tracing.Exporter,
+		tracing.ServiceName(cfg.App.Name),
+		tracing.ServiceVersion(cfg.App.Version),
+		tracing.Endpoint(cfg.Tracing.Endpoint),
+		tracing.SampleRatio(cfg.Tracing.SampleRatio),
+	)
+	if err != nil {
+		l.Fatal().Err(err).Msg("app - Run - tracing.New")
+	}
+	defer func() {
+		if err := tracer.Shutdown(context.Background()); err != nil {
+			l.Err(err).Msg("app - Run - tracer.Shutdown")
+		}
+	}()
+
 	// Postgres
 	pg, err := postgres.New(cfg.PG.URL, postgres.MaxPoolSize(cfg.PG.PoolMax))
 	if err != nil {
@@ -41,23 +62,106 @@ func Run() {
 	if err != nil {
 		l.Fatal().Err(err).Msg("app - Run - redis.New")
 	}
+	defer rdb.Close()
+
+	// Banners are served from Postgres until Redis becomes reachable.
+	if err = rdb.Ping(context.Background()); err != nil {
+		l.Warn().Err(err).Msg("app - Run - rdb.Ping: starting without cache")
+	}
+
+	// Metrics
+	prometheus.MustRegister(postgres.NewCollector(pg), redis.NewCollector(rdb))
 
 	// Repositories
-	repositories := repository.NewRepositories(l, pg, rdb)
+	repositories := repository.NewRepositories(l, pg, rdb, repository.CacheConfig{
+		KeyPrefix:       cfg.Cache.KeyPrefix,
+		LocalSize:       cfg.LocalCache.Size,
+		LocalTTL:        cfg.LocalCache.TTL,
+		BreakerFailures: cfg.Redis.BreakerFailures,
+		BreakerCooldown: cfg.Redis.BreakerCooldown,
+	})
+
+	// External identity provider
+	var tokenVerifiers []service.TokenVerifier
+	if cfg.OIDC.Issuer != "" {
+		if cfg.OIDC.JWKS == "" {
+			l.Fatal().Msg("app - Run - oidc: jwks is required when issuer is set")
+		}
+
+		keys := jwks.New(cfg.OIDC.JWKS, jwks.RefreshInterval(cfg.OIDC.JWKSRefresh), jwks.CacheFile(cfg.OIDC.JWKSCacheFile))
+		tokenVerifiers = append(tokenVerifiers, service.NewOIDCVerifier(keys, service.OIDCConfig{
+			Issuer:        cfg.OIDC.Issuer,
+			Audience:      cfg.OIDC.Audience,
+			UsernameClaim: cfg.OIDC.UsernameClaim,
+			RoleClaim:     cfg.OIDC.RoleClaim,
+			AdminValues:   cfg.OIDC.AdminRoleValues,
+		}))
+	}
 
 	// Services dependencies
 	deps := service.ServicesDependencies{
 		Repositories: repositories,
-		SignKey:      cfg.JWT.SignKey,
-		TokenTTL:     cfg.JWT.TokenTTL,
-		Salt:         cfg.JWT.Salt,
+		Tokens: service.TokenConfig{
+			SignKey:            cfg.JWT.SignKey,
+			AccessTTL:          cfg.JWT.TokenTTL,
+			RefreshTTL:         cfg.JWT.RefreshTokenTTL,
+			Algorithm:          cfg.JWT.Algorithm,
+			KeyRotation:        cfg.JWT.KeyRotation,
+			RevocationFailOpen: cfg.JWT.RevocationFailOpen,
+		},
+		Salt: cfg.JWT.Salt,
+		Registration: service.RegistrationConfig{
+			Open:           cfg.Registration.Open,
+			BootstrapToken: cfg.Registration.BootstrapToken,
+		},
+		TokenVerifiers:  tokenVerifiers,
+		JobPollInterval: cfg.Jobs.PollInterval,
+		JobBatchSize:    cfg.Jobs.BatchSize,
+		TrashRetention:  cfg.Trash.Retention,
+		TrashPurgeEvery: cfg.Trash.PurgeInterval,
+		BannerCache: service.BannerCacheConfig{
+			Enabled:          cfg.Cache.Enabled,
+			TTL:              cfg.Cache.TTL,
+			Jitter:           cfg.Cache.Jitter,
+			StaleTTL:         cfg.Cache.StaleTTL,
+			EarlyRefreshBeta: cfg.Cache.EarlyRefreshBeta,
+			NotFoundTTL:      cfg.Cache.NotFoundTTL,
+			WarmUpBatchSize:  cfg.Cache.WarmUpBatchSize,
+		},
 	}
 	services := service.NewServices(l, deps)
 
+	// Tokens cannot be issued until a signing key is loaded.
+	if err = services.Auth.RotateKeys(context.Background()); err != nil {
+		l.Fatal().Err(err).Msg("app - Run - services.Auth.RotateKeys")
+	}
+
+	// Background jobs
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	go services.Job.Run(jobsCtx)
+	go services.Cache.Run(jobsCtx)
+	go services.Auth.Run(jobsCtx)
+
+	if cfg.Cache.WarmUpOnStart {
+		go func() {
+			warmed, err := services.Cache.WarmUp(jobsCtx)
+			if err != nil {
+				l.Err(err).Msg("app - Run - services.Cache.WarmUp")
+				return
+			}
+			l.Info().Int("banners", warmed).Msg("app - Run - cache warmed up")
+		}()
+	}
+
 	// HTTP Server
 	handler := v1.NewRouter(l, services)
 	httpServer := httpserver.New(handler, httpserver.Port(cfg.HTTP.Port))
 
+	// Metrics server, kept off the public port
+	metricsServer := httpserver.New(promhttp.Handler(), httpserver.Port(cfg.Metrics.Port))
+
 	// Waiting signal
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
@@ -67,11 +171,20 @@ func Run() {
 		l.Info().Msg("app - Run - signal: " + s.String())
 	case err = <-httpServer.Notify():
 		l.Err(err).Msg("app - Run - httpServer.Notify")
+	case err = <-metricsServer.Notify():
+		l.Err(err).Msg("app - Run - metricsServer.Notify")
 	}
 
 	// Shutdown
+	cancelJobs()
+
 	err = httpServer.Shutdown()
 	if err != nil {
 		l.Err(err).Msg("app - Run - httpServer.Shutdown")
 	}
+
+	err = metricsServer.Shutdown()
+	if err != nil {
+		l.Err(err).Msg("app - Run - metricsServer.Shutdown")
+	}
 }
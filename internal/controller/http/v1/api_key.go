@@ -0,0 +1,95 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/realPointer/banners/internal/controller/http/v1/middlewares"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type apiKeyRoutes struct {
+	apiKeyService service.APIKey
+	l             *zerolog.Logger
+}
+
+func NewAPIKeyRouter(apiKeyService service.APIKey, l *zerolog.Logger) http.Handler {
+	s := &apiKeyRoutes{
+		apiKeyService: apiKeyService,
+		l:             l,
+	}
+	r := chi.NewRouter()
+
+	r.Get("/", s.getAPIKeys)
+	r.Post("/", s.createAPIKey)
+	r.Delete("/{apiKeyID:[0-9]+}", s.revokeAPIKey)
+
+	return r
+}
+
+func (s *apiKeyRoutes) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.apiKeyService.GetAPIKeys(r.Context())
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.JSON(w, r, keys)
+}
+
+func (s *apiKeyRoutes) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Name      string     `json:"name"`
+		Role      string     `json:"role"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.apiKeyService.CreateAPIKey(ctx, req.Name, req.Role, req.ExpiresAt, middlewares.Username(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidName), errors.Is(err, service.ErrInvalidRole),
+			errors.Is(err, service.ErrInvalidExpiry):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, key)
+}
+
+func (s *apiKeyRoutes) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	apiKeyID, err := strconv.Atoi(chi.URLParam(r, "apiKeyID"))
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.apiKeyService.RevokeAPIKey(r.Context(), apiKeyID); err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrAPIKeyNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.NoContent(w, r)
+}
@@ -2,10 +2,17 @@ package v1
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/realPointer/banners/internal/controller/http/v1/middlewares"
+	"github.com/realPointer/banners/internal/entity"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
 	"github.com/realPointer/banners/internal/service"
+	"github.com/realPointer/banners/pkg/logger"
 	"github.com/rs/zerolog"
 )
 
@@ -14,7 +21,8 @@ type authRoutes struct {
 	l           *zerolog.Logger
 }
 
-func NewAuthRouter(authService service.Auth, l *zerolog.Logger) http.Handler {
+// NewAuthRouter serves the authentication endpoints. authenticate guards the ones that need a signed-in caller.
+func NewAuthRouter(authService service.Auth, authenticate func(http.Handler) http.Handler, l *zerolog.Logger) http.Handler {
 	s := &authRoutes{
 		authService: authService,
 		l:           l,
@@ -22,7 +30,10 @@ func NewAuthRouter(authService service.Auth, l *zerolog.Logger) http.Handler {
 	r := chi.NewRouter()
 
 	r.Post("/register", s.registerHandler)
+	r.Post("/bootstrap", s.bootstrapHandler)
 	r.Post("/login", s.loginHandler)
+	r.Post("/refresh", s.refreshHandler)
+	r.With(authenticate).Post("/logout", s.logoutHandler)
 
 	return r
 }
@@ -39,19 +50,70 @@ func (s *authRoutes) registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Role != "admin" && req.Role != "user" {
+	switch req.Role {
+	case "", entity.RoleUser:
+	case entity.RoleAdmin:
+		http.Error(w, "Admin accounts can only be created by admins", http.StatusForbidden)
+		return
+	default:
 		http.Error(w, "Invalid role", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.authService.Register(r.Context(), req.Username, req.Password, req.Role); err != nil {
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+	if err := s.authService.Register(r.Context(), req.Username, req.Password); err != nil {
+		switch {
+		case errors.Is(err, service.ErrRegistrationClosed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrInvalidName):
+			http.Error(w, "Invalid username", http.StatusBadRequest)
+		case errors.Is(err, postgresrepo.ErrUserExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logger.FromContext(r.Context(), s.l).Err(err).Str("username", req.Username).
+				Msg("authRoutes.registerHandler - s.authService.Register")
+			http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
 }
 
+// bootstrapHandler creates the first admin account. The caller proves it may do so with the
+// bootstrap token from the configuration, sent in the X-Bootstrap-Token header.
+func (s *authRoutes) bootstrapHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := s.authService.Bootstrap(r.Context(), r.Header.Get("X-Bootstrap-Token"), req.Username, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBootstrapDisabled):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidBootstrapToken):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, service.ErrInvalidName):
+			http.Error(w, "Invalid username", http.StatusBadRequest)
+		case errors.Is(err, postgresrepo.ErrAdminExists), errors.Is(err, postgresrepo.ErrUserExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	logger.FromContext(r.Context(), s.l).Info().Str("username", req.Username).Msg("authRoutes.bootstrapHandler - admin created")
+
+	w.WriteHeader(http.StatusCreated)
+}
+
 func (s *authRoutes) loginHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Username string `json:"username"`
@@ -69,15 +131,62 @@ func (s *authRoutes) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := struct {
-		Token string `json:"token"`
-	}{
-		Token: token,
+	render.JSON(w, r, token)
+}
+
+func (s *authRoutes) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	token, err := s.authService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrRefreshTokenNotFound), errors.Is(err, postgresrepo.ErrRefreshTokenReused):
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.JSON(w, r, token)
+}
+
+// logoutHandler revokes the access token it is called with and, when given, its refresh token.
+func (s *authRoutes) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// The body is optional: without a refresh token only the access token is revoked.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authService.Logout(r.Context(), middlewares.Claims(r.Context()), req.RefreshToken); err != nil {
+		internalError(w, r, s.l, err)
 		return
 	}
+
+	render.NoContent(w, r)
+}
+
+// _jwksMaxAge is how long clients may cache the key set. A new key signs once every instance has
+// loaded it and a minute more, so it must stay below a minute.
+const _jwksMaxAge = "max-age=30"
+
+// newJWKSHandler serves the public keys access tokens are signed with, so other services can
+// verify them without a shared secret.
+func newJWKSHandler(authService service.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", _jwksMaxAge)
+		render.JSON(w, r, authService.JWKS())
+	}
 }
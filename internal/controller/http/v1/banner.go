@@ -3,6 +3,7 @@ package v1
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -35,8 +36,15 @@ func NewBannerRouter(bannerService service.Banner, l *zerolog.Logger) http.Handl
 		r.Route("/banner", func(r chi.Router) {
 			r.Get("/", s.getBanners)
 			r.Post("/", s.createBanner)
+			r.Get("/trash", s.getDeletedBanners)
+			r.Post("/{bannerID:[0-9]+}/restore", s.restoreBanner)
 			r.Patch("/{bannerID:[0-9]+}", s.updateBanner)
 			r.Delete("/{bannerID:[0-9]+}", s.deleteBanner)
+			r.Get("/{bannerID:[0-9]+}/versions", s.getBannerVersions)
+			r.Get("/{bannerID:[0-9]+}/versions/{version:[0-9]+}", s.getBannerVersion)
+			r.Post("/{bannerID:[0-9]+}/versions/{version:[0-9]+}/rollback", s.rollbackBanner)
+			r.Post("/{bannerID:[0-9]+}/versions/{version:[0-9]+}/pin", s.pinBannerVersion)
+			r.Delete("/{bannerID:[0-9]+}/pin", s.unpinBannerVersion)
 			r.Delete("/feature/{featureID:[0-9]+}", s.deleteBannersByFeatureId)
 			r.Delete("/tag/{tagID:[0-9]+}", s.deleteBannersByTagId)
 		})
@@ -81,13 +89,31 @@ func (s *bannerRoutes) getBanner(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	banner, err := s.bannerService.GetBanner(ctx, tagID, featureID, useLastRevision)
+	var version *int
+	if versionStr := r.URL.Query().Get("version"); versionStr != "" {
+		// A version may be staged content that is not shown to users yet, so only admins may request one.
+		if middlewares.Role(ctx) != entity.RoleAdmin {
+			http.Error(w, "Only admins may request a banner version", http.StatusForbidden)
+			return
+		}
+
+		v, err := strconv.Atoi(versionStr)
+		if err != nil || v < 1 {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+		version = &v
+	}
+
+	subjectKey := r.URL.Query().Get("subject_key")
+
+	banner, err := s.bannerService.GetBanner(ctx, tagID, featureID, version, subjectKey, useLastRevision)
 	if err != nil {
 		switch {
 		case errors.Is(err, postgresrepo.ErrBannerNotFound):
 			http.Error(w, err.Error(), http.StatusNotFound)
 		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			internalError(w, r, s.l, err)
 		}
 		return
 	}
@@ -96,8 +122,16 @@ func (s *bannerRoutes) getBanner(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *bannerRoutes) getBanners(w http.ResponseWriter, r *http.Request) {
+	s.listBanners(w, r, false)
+}
+
+func (s *bannerRoutes) getDeletedBanners(w http.ResponseWriter, r *http.Request) {
+	s.listBanners(w, r, true)
+}
+
+func (s *bannerRoutes) listBanners(w http.ResponseWriter, r *http.Request, deleted bool) {
 	ctx := r.Context()
-	filter := &entity.BannerFilter{}
+	filter := &entity.BannerFilter{Deleted: deleted}
 
 	if featureID := r.URL.Query().Get("feature_id"); featureID != "" {
 		id, err := strconv.Atoi(featureID)
@@ -137,7 +171,7 @@ func (s *bannerRoutes) getBanners(w http.ResponseWriter, r *http.Request) {
 
 	banners, err := s.bannerService.GetBanners(ctx, filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, s.l, err)
 		return
 	}
 
@@ -157,9 +191,19 @@ func (s *bannerRoutes) createBanner(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if banner.ActiveFrom != nil && banner.ActiveUntil != nil && !banner.ActiveUntil.After(*banner.ActiveFrom) {
+		http.Error(w, "active_until must be after active_from", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateVariants(banner.Variants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	bannerID, err := s.bannerService.CreateBanner(ctx, &banner)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, s.l, err)
 		return
 	}
 
@@ -182,18 +226,31 @@ func (s *bannerRoutes) updateBanner(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(update.TagIDs) == 0 && update.FeatureID == nil && len(update.Content) == 0 && update.IsActive == nil {
+	if len(update.TagIDs) == 0 && update.FeatureID == nil && len(update.Content) == 0 && update.Variants == nil &&
+		update.IsActive == nil && !update.ActiveFrom.Set && !update.ActiveUntil.Set {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
+	if update.ActiveFrom.Time != nil && update.ActiveUntil.Time != nil && !update.ActiveUntil.Time.After(*update.ActiveFrom.Time) {
+		http.Error(w, "active_until must be after active_from", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateVariants(update.Variants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = s.bannerService.UpdateBanner(ctx, bannerID, &update)
 	if err != nil {
 		switch {
 		case errors.Is(err, postgresrepo.ErrBannerNotFound):
 			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, postgresrepo.ErrInvalidActiveWindow):
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			internalError(w, r, s.l, err)
 		}
 		return
 	}
@@ -210,13 +267,22 @@ func (s *bannerRoutes) deleteBanner(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.bannerService.DeleteBanner(ctx, bannerID)
+	hard := false
+	if hardStr := r.URL.Query().Get("hard"); hardStr != "" {
+		hard, err = strconv.ParseBool(hardStr)
+		if err != nil {
+			http.Error(w, "Invalid value for hard. Allowed values: true, false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.bannerService.DeleteBanner(ctx, bannerID, middlewares.Username(ctx), hard)
 	if err != nil {
 		switch {
 		case errors.Is(err, postgresrepo.ErrBannerNotFound):
 			http.Error(w, err.Error(), http.StatusNotFound)
 		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			internalError(w, r, s.l, err)
 		}
 		return
 	}
@@ -233,13 +299,14 @@ func (s *bannerRoutes) deleteBannersByFeatureId(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = s.bannerService.DeleteBannersByFeatureID(ctx, featureID)
+	jobID, err := s.bannerService.DeleteBannersByFeatureID(ctx, featureID, middlewares.Username(ctx))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, s.l, err)
 		return
 	}
 
-	render.NoContent(w, r)
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, map[string]int{"job_id": jobID})
 }
 
 func (s *bannerRoutes) deleteBannersByTagId(w http.ResponseWriter, r *http.Request) {
@@ -250,11 +317,195 @@ func (s *bannerRoutes) deleteBannersByTagId(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = s.bannerService.DeleteBannersByTagID(ctx, tagID)
+	jobID, err := s.bannerService.DeleteBannersByTagID(ctx, tagID, middlewares.Username(ctx))
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, map[string]int{"job_id": jobID})
+}
+
+func (s *bannerRoutes) getBannerVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.bannerService.GetBannerVersions(ctx, bannerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.JSON(w, r, versions)
+}
+
+func (s *bannerRoutes) getBannerVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	bannerVersion, err := s.bannerService.GetBannerVersion(ctx, bannerID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerVersionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.JSON(w, r, bannerVersion)
+}
+
+func (s *bannerRoutes) rollbackBanner(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	err = s.bannerService.RollbackBanner(ctx, bannerID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerNotFound), errors.Is(err, postgresrepo.ErrBannerVersionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
 		return
 	}
 
 	render.NoContent(w, r)
 }
+
+func (s *bannerRoutes) pinBannerVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	err = s.bannerService.PinBannerVersion(ctx, bannerID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerNotFound), errors.Is(err, postgresrepo.ErrBannerVersionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s *bannerRoutes) unpinBannerVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.bannerService.UnpinBannerVersion(ctx, bannerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s *bannerRoutes) restoreBanner(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bannerID, err := strconv.Atoi(chi.URLParam(r, "bannerID"))
+	if err != nil {
+		http.Error(w, "Invalid banner ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.bannerService.RestoreBanner(ctx, bannerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrBannerNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, postgresrepo.ErrBannerConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// _maxVariantsWeight caps the total weight of the variants of a banner. A variant is picked by a
+// 32-bit hash of the subject modulo the total, which only splits subjects in proportion to the
+// weights while the total stays far below 2^32.
+const _maxVariantsWeight = 1_000_000
+
+func validateVariants(variants []entity.BannerVariant) error {
+	names := make(map[string]struct{}, len(variants))
+	totalWeight := 0
+	for _, variant := range variants {
+		if variant.Name == "" || len(variant.Content) == 0 {
+			return errors.New("variant name and content are required")
+		}
+
+		if variant.Weight <= 0 || variant.Weight > _maxVariantsWeight {
+			return fmt.Errorf("invalid weight for variant %q", variant.Name)
+		}
+
+		totalWeight += variant.Weight
+		if totalWeight > _maxVariantsWeight {
+			return fmt.Errorf("total weight of variants must not exceed %d", _maxVariantsWeight)
+		}
+
+		if _, ok := names[variant.Name]; ok {
+			return fmt.Errorf("duplicate variant %q", variant.Name)
+		}
+		names[variant.Name] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type cacheRoutes struct {
+	cacheService service.Cache
+	l            *zerolog.Logger
+}
+
+func NewCacheRouter(cacheService service.Cache, l *zerolog.Logger) http.Handler {
+	s := &cacheRoutes{
+		cacheService: cacheService,
+		l:            l,
+	}
+	r := chi.NewRouter()
+
+	r.Get("/stats", s.getStats)
+	r.Delete("/", s.flush)
+	r.Post("/warmup", s.warmUp)
+	r.Get("/ttl", s.getFeatureTTLs)
+	r.Put("/ttl/{featureID:[0-9]+}", s.setFeatureTTL)
+	r.Delete("/ttl/{featureID:[0-9]+}", s.deleteFeatureTTL)
+
+	return r
+}
+
+func (s *cacheRoutes) getStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	countKeys := false
+	if keysParam := r.URL.Query().Get("keys"); keysParam != "" {
+		var err error
+		countKeys, err = strconv.ParseBool(keysParam)
+		if err != nil {
+			http.Error(w, "Invalid value for keys. Allowed values: true, false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := s.cacheService.Stats(ctx, countKeys)
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.JSON(w, r, stats)
+}
+
+func (s *cacheRoutes) flush(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var featureID, tagID *int
+	if featureIDParam := r.URL.Query().Get("feature_id"); featureIDParam != "" {
+		id, err := strconv.Atoi(featureIDParam)
+		if err != nil {
+			http.Error(w, "Invalid feature_id", http.StatusBadRequest)
+			return
+		}
+		featureID = &id
+	}
+
+	if tagIDParam := r.URL.Query().Get("tag_id"); tagIDParam != "" {
+		id, err := strconv.Atoi(tagIDParam)
+		if err != nil {
+			http.Error(w, "Invalid tag_id", http.StatusBadRequest)
+			return
+		}
+		tagID = &id
+	}
+
+	deleted, err := s.cacheService.Flush(ctx, featureID, tagID)
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]int{"deleted": deleted})
+}
+
+func (s *cacheRoutes) warmUp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	warmed, err := s.cacheService.WarmUp(ctx)
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.JSON(w, r, map[string]int{"warmed": warmed})
+}
+
+func (s *cacheRoutes) getFeatureTTLs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ttls, err := s.cacheService.GetFeatureTTLs(ctx)
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.JSON(w, r, ttls)
+}
+
+type featureTTLRequest struct {
+	TTLSeconds *int `json:"ttl_seconds"`
+}
+
+func (s *cacheRoutes) setFeatureTTL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	featureID, err := strconv.Atoi(chi.URLParam(r, "featureID"))
+	if err != nil {
+		http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+		return
+	}
+
+	var req featureTTLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TTLSeconds == nil || *req.TTLSeconds < 0 {
+		http.Error(w, "ttl_seconds must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+
+	err = s.cacheService.SetFeatureTTL(ctx, featureID, time.Duration(*req.TTLSeconds)*time.Second)
+	if err != nil {
+		internalError(w, r, s.l, err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s *cacheRoutes) deleteFeatureTTL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	featureID, err := strconv.Atoi(chi.URLParam(r, "featureID"))
+	if err != nil {
+		http.Error(w, "Invalid feature ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.cacheService.DeleteFeatureTTL(ctx, featureID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrFeatureTTLNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.NoContent(w, r)
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type jobRoutes struct {
+	jobService service.Job
+	l          *zerolog.Logger
+}
+
+func NewJobRouter(jobService service.Job, l *zerolog.Logger) http.Handler {
+	s := &jobRoutes{
+		jobService: jobService,
+		l:          l,
+	}
+	r := chi.NewRouter()
+
+	r.Get("/{jobID:[0-9]+}", s.getJob)
+
+	return r
+}
+
+func (s *jobRoutes) getJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	jobID, err := strconv.Atoi(chi.URLParam(r, "jobID"))
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.jobService.GetJob(ctx, jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgresrepo.ErrJobNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	render.JSON(w, r, job)
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestLogger writes an access log entry for every request. It attaches a logger carrying
+// the request ID to the request context, so services and repositories log with it too.
+// It must run after middleware.RequestID.
+func RequestLogger(l *zerolog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := middleware.GetReqID(r.Context())
+			w.Header().Set(middleware.RequestIDHeader, requestID)
+
+			logContext := l.With().Str("request_id", requestID)
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+				logContext = logContext.Str("trace_id", spanContext.TraceID().String())
+			}
+			requestLogger := logContext.Logger()
+			ctx := requestLogger.WithContext(r.Context())
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// The context logger, not requestLogger, holds the user and role added by AuthMiddleware.
+			zerolog.Ctx(ctx).Info().
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("route", chi.RouteContext(r.Context()).RoutePattern()).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("latency", time.Since(start)).
+				Msg("request")
+		})
+	}
+}
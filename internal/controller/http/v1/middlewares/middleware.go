@@ -2,34 +2,69 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
 )
 
 type contextKey string
 
-const roleContextKey contextKey = "role"
+const (
+	roleContextKey     contextKey = "role"
+	usernameContextKey contextKey = "username"
+	claimsContextKey   contextKey = "claims"
+)
 
-func AuthMiddleware(authService service.Auth) func(next http.Handler) http.Handler {
+// AuthMiddleware authenticates requests by the API key in the X-API-Key header or, without one,
+// by the access token in the Authorization header.
+func AuthMiddleware(authService service.Auth, apiKeyService service.APIKey) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			tokenString := r.Header.Get("Authorization")
-			if tokenString == "" {
-				http.Error(w, "Missing token", http.StatusUnauthorized)
-				return
-			}
+			var claims *service.TokenClaims
+
+			if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+				var err error
+				claims, err = apiKeyService.Authenticate(r.Context(), apiKey)
+				if err != nil {
+					if !errors.Is(err, service.ErrInvalidAPIKey) {
+						zerolog.Ctx(r.Context()).Err(err).Msg("AuthMiddleware - apiKeyService.Authenticate")
+					}
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+			} else {
+				tokenString := r.Header.Get("Authorization")
+				if tokenString == "" {
+					http.Error(w, "Missing token", http.StatusUnauthorized)
+					return
+				}
 
-			tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+				tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-			claims, err := authService.ParseToken(tokenString)
-			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
+				var err error
+				claims, err = authService.ParseToken(r.Context(), tokenString)
+				if err != nil {
+					if errors.Is(err, service.ErrRevocationUnavailable) {
+						zerolog.Ctx(r.Context()).Err(err).Msg("AuthMiddleware - authService.ParseToken")
+						http.Error(w, "Token revocation list unavailable", http.StatusServiceUnavailable)
+						return
+					}
+					http.Error(w, "Invalid token", http.StatusUnauthorized)
+					return
+				}
 			}
 
 			ctx := context.WithValue(r.Context(), roleContextKey, claims.Role)
+			ctx = context.WithValue(ctx, usernameContextKey, claims.Username)
+			ctx = context.WithValue(ctx, claimsContextKey, claims)
+
+			zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("user", claims.Username).Str("role", claims.Role)
+			})
+
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -45,3 +80,21 @@ func AdminOnly(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Role returns the role of the user authenticated by AuthMiddleware.
+func Role(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey).(string)
+	return role
+}
+
+// Username returns the name of the user authenticated by AuthMiddleware.
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(usernameContextKey).(string)
+	return username
+}
+
+// Claims returns the access token claims verified by AuthMiddleware.
+func Claims(ctx context.Context) *service.TokenClaims {
+	claims, _ := ctx.Value(claimsContextKey).(*service.TokenClaims)
+	return claims
+}
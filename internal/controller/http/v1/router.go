@@ -10,12 +10,16 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/realPointer/banners/internal/controller/http/v1/middlewares"
 	"github.com/realPointer/banners/internal/service"
+	"github.com/realPointer/banners/pkg/logger"
 	"github.com/rs/zerolog"
 )
 
 func NewRouter(l *zerolog.Logger, Services *service.Services) *chi.Mux {
 	router := chi.NewRouter()
-	router.Use(middleware.Logger)
+	router.Use(middleware.RequestID)
+	router.Use(middlewares.Tracing)
+	router.Use(middlewares.RequestLogger(l))
+	router.Use(middlewares.Metrics)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Timeout(time.Minute))
 
@@ -23,12 +27,24 @@ func NewRouter(l *zerolog.Logger, Services *service.Services) *chi.Mux {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	router.Get("/.well-known/jwks.json", newJWKSHandler(Services.Auth))
+
+	authenticate := middlewares.AuthMiddleware(Services.Auth, Services.APIKey)
+
 	router.Route("/v1", func(r chi.Router) {
-		r.Mount("/auth", NewAuthRouter(Services.Auth, l))
+		r.Mount("/auth", NewAuthRouter(Services.Auth, authenticate, l))
 
 		r.Group(func(r chi.Router) {
-			r.Use(middlewares.AuthMiddleware(Services.Auth))
+			r.Use(authenticate)
 			r.Mount("/", NewBannerRouter(Services.Banner, l))
+
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.AdminOnly)
+				r.Mount("/jobs", NewJobRouter(Services.Job, l))
+				r.Mount("/admin/cache", NewCacheRouter(Services.Cache, l))
+				r.Mount("/admin/users", NewUserRouter(Services.Auth, l))
+				r.Mount("/auth/api-keys", NewAPIKeyRouter(Services.APIKey, l))
+			})
 		})
 	})
 
@@ -46,7 +62,7 @@ func AuthMiddleware(authService service.Auth) func(next http.Handler) http.Handl
 
 			tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-			claims, err := authService.ParseToken(tokenString)
+			claims, err := authService.ParseToken(r.Context(), tokenString)
 			if err != nil {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
@@ -57,3 +73,9 @@ func AuthMiddleware(authService service.Auth) func(next http.Handler) http.Handl
 		})
 	}
 }
+
+// internalError logs err with the request logger and responds with 500 Internal Server Error.
+func internalError(w http.ResponseWriter, r *http.Request, l *zerolog.Logger, err error) {
+	logger.FromContext(r.Context(), l).Err(err).Str("path", r.URL.Path).Msg("v1 - internal error")
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
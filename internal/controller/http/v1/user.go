@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type userRoutes struct {
+	authService service.Auth
+	l           *zerolog.Logger
+}
+
+func NewUserRouter(authService service.Auth, l *zerolog.Logger) http.Handler {
+	s := &userRoutes{
+		authService: authService,
+		l:           l,
+	}
+	r := chi.NewRouter()
+
+	r.Post("/", s.createUser)
+
+	return r
+}
+
+func (s *userRoutes) createUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.authService.CreateUser(r.Context(), req.Username, req.Password, req.Role); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRole):
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+		case errors.Is(err, service.ErrInvalidName):
+			http.Error(w, "Invalid username", http.StatusBadRequest)
+		case errors.Is(err, postgresrepo.ErrUserExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			internalError(w, r, s.l, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
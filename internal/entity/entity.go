@@ -5,6 +5,11 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	Username  string    `json:"username"`
 	Password  string    `json:"password"`
@@ -12,21 +17,90 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type UserBanner struct {
+	BannerID    int             `json:"banner_id"`
+	Content     json.RawMessage `json:"content"`
+	Variants    []BannerVariant `json:"variants"`
+	ActiveUntil *time.Time      `json:"active_until"`
+	// CacheTTL overrides how long the banner is cached. It is not cached itself.
+	CacheTTL *time.Duration `json:"-"`
+}
+
+// CacheStats describes the banner cache lookups of the instance that serves it since that
+// instance started. Keys is the number of banner keys in the shared cache, counted on request.
+type CacheStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Errors   int64   `json:"errors"`
+	Bypasses int64   `json:"bypasses"`
+	HitRatio float64 `json:"hit_ratio"`
+	Keys     *int    `json:"keys,omitempty"`
+}
+
+// FeatureCacheTTL overrides the banner cache TTL for every banner of a feature.
+type FeatureCacheTTL struct {
+	FeatureID  int       `json:"feature_id"`
+	TTLSeconds int       `json:"ttl_seconds"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FeatureTag is a feature/tag pair a banner is served for.
+type FeatureTag struct {
+	FeatureID int
+	TagID     int
+}
+
+// ActiveBanner is the banner users currently see for a feature/tag pair.
+type ActiveBanner struct {
+	FeatureID int
+	TagID     int
+	Banner    UserBanner
+}
+
+// CacheItem is a value written to the cache together with its expiration.
+type CacheItem struct {
+	Key        string
+	Value      []byte
+	Expiration time.Duration
+}
+
+type BannerVariant struct {
+	Name    string          `json:"name"`
+	Weight  int             `json:"weight"`
+	Content json.RawMessage `json:"content"`
+}
+
 type BannerInfo struct {
-	BannerID  int             `json:"banner_id"`
-	TagIDs    []int           `json:"tag_ids"`
-	FeatureID int             `json:"feature_id"`
+	BannerID      int             `json:"banner_id"`
+	TagIDs        []int           `json:"tag_ids"`
+	FeatureID     int             `json:"feature_id"`
+	Content       json.RawMessage `json:"content"`
+	Variants      []BannerVariant `json:"variants"`
+	IsActive      bool            `json:"is_active"`
+	PinnedVersion *int            `json:"pinned_version"`
+	ActiveFrom    *time.Time      `json:"active_from"`
+	ActiveUntil   *time.Time      `json:"active_until"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	DeletedAt     *time.Time      `json:"deleted_at,omitempty"`
+	DeletedBy     *string         `json:"deleted_by,omitempty"`
+}
+
+type BannerVersion struct {
+	Version   int             `json:"version"`
 	Content   json.RawMessage `json:"content"`
-	IsActive  bool            `json:"is_active"`
+	Variants  []BannerVariant `json:"variants"`
 	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
 }
 
 type BannerCreate struct {
-	TagIDs    []int           `json:"tag_ids"`
-	FeatureID *int            `json:"feature_id"`
-	Content   json.RawMessage `json:"content"`
-	IsActive  bool            `json:"is_active"`
+	TagIDs      []int           `json:"tag_ids"`
+	FeatureID   *int            `json:"feature_id"`
+	Content     json.RawMessage `json:"content"`
+	Variants    []BannerVariant `json:"variants"`
+	IsActive    bool            `json:"is_active"`
+	ActiveFrom  *time.Time      `json:"active_from"`
+	ActiveUntil *time.Time      `json:"active_until"`
 }
 
 type BannerFilter struct {
@@ -34,11 +108,117 @@ type BannerFilter struct {
 	TagID     *int `json:"tag_id"`
 	Limit     *int `json:"limit"`
 	Offset    *int `json:"offset"`
+	Deleted   bool `json:"deleted"`
 }
 
 type BannerUpdate struct {
-	TagIDs    []int           `json:"tag_ids"`
-	FeatureID *int            `json:"feature_id"`
-	Content   json.RawMessage `json:"content"`
-	IsActive  *bool           `json:"is_active"`
+	TagIDs      []int           `json:"tag_ids"`
+	FeatureID   *int            `json:"feature_id"`
+	Content     json.RawMessage `json:"content"`
+	Variants    []BannerVariant `json:"variants"`
+	IsActive    *bool           `json:"is_active"`
+	ActiveFrom  NullableTime    `json:"active_from"`
+	ActiveUntil NullableTime    `json:"active_until"`
+}
+
+// NullableTime is a time field of a partial update. Set tells a field sent as null, which
+// clears the stored value, from a field left out, which keeps it.
+type NullableTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	t.Time = nil
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	return json.Unmarshal(data, &t.Time)
+}
+
+const (
+	JobKindDeleteByFeature = "delete_by_feature"
+	JobKindDeleteByTag     = "delete_by_tag"
+
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+type Job struct {
+	ID        int       `json:"job_id"`
+	Kind      string    `json:"kind"`
+	TargetID  int       `json:"target_id"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Processed int       `json:"processed"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedBy *string   `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RefreshToken is a server-side refresh token. Tokens issued by rotating one another share a family.
+type RefreshToken struct {
+	FamilyID string
+	Username string
+}
+
+// TokenPair is issued on login and on every refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// SigningKey is a key access tokens are signed with, identified in tokens by its ID (kid).
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	// PrivateKey is the PKCS #8 private key, encrypted before it is stored.
+	PrivateKey []byte
+	CreatedAt  time.Time
+	// ExpiresAt is when the key stops verifying tokens.
+	ExpiresAt time.Time
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// N and E are set for RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are set for Ed25519 keys.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// APIKey is a long-lived credential for service-to-service calls. Only its hash is stored.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// CreatedAPIKey is returned once, when the key is issued. The key cannot be shown again.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
 }
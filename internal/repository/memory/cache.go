@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+)
+
+// Cache is the cache tier CacheRepo falls back to on a local miss.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetMany(ctx context.Context, items []entity.CacheItem) error
+	Keys(ctx context.Context, pattern string) ([]string, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+type entry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// CacheRepo is a bounded in-process LRU cache in front of another cache. Entries live locally
+// for at most ttl, so values written by other instances become visible after that delay unless
+// they are evicted earlier with Evict.
+type CacheRepo struct {
+	next  Cache
+	size  int
+	ttl   time.Duration
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+func NewCacheRepo(next Cache, size int, ttl time.Duration) *CacheRepo {
+	return &CacheRepo{
+		next:  next,
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+func (r *CacheRepo) Get(ctx context.Context, key string) (string, error) {
+	if value, ok := r.getLocal(key); ok {
+		return value, nil
+	}
+
+	value, err := r.next.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if value != "" {
+		r.setLocal(key, value, r.ttl)
+	}
+
+	return value, nil
+}
+
+// Set keeps the value locally even if the next tier fails, so hot keys are still served while it is down.
+func (r *CacheRepo) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	ttl := r.ttl
+	if expiration > 0 {
+		ttl = min(ttl, expiration)
+	}
+	r.setLocal(key, toString(value), ttl)
+
+	return r.next.Set(ctx, key, value, expiration)
+}
+
+// SetMany writes items to the next tier only, so a bulk load does not push hot keys out of the
+// local cache. Local copies of the written keys are dropped to pick up the new values.
+func (r *CacheRepo) SetMany(ctx context.Context, items []entity.CacheItem) error {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	r.deleteLocal(keys...)
+
+	return r.next.SetMany(ctx, items)
+}
+
+// Keys lists the matching keys of the next tier, which holds every key of the local cache too.
+func (r *CacheRepo) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return r.next.Keys(ctx, pattern)
+}
+
+func (r *CacheRepo) Delete(ctx context.Context, keys ...string) error {
+	r.deleteLocal(keys...)
+	return r.next.Delete(ctx, keys...)
+}
+
+// Evict drops keys from the local cache only, leaving the next tier untouched.
+func (r *CacheRepo) Evict(keys ...string) {
+	r.deleteLocal(keys...)
+}
+
+func (r *CacheRepo) getLocal(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.items[key]
+	if !ok {
+		return "", false
+	}
+
+	e := elem.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		r.removeElement(elem)
+		return "", false
+	}
+
+	r.order.MoveToFront(elem)
+	return e.value, true
+}
+
+func (r *CacheRepo) setLocal(key, value string, ttl time.Duration) {
+	if ttl <= 0 || r.size <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+
+	if elem, ok := r.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expiresAt = expiresAt
+		r.order.MoveToFront(elem)
+		return
+	}
+
+	r.items[key] = r.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+
+	for r.order.Len() > r.size {
+		r.removeElement(r.order.Back())
+	}
+}
+
+func (r *CacheRepo) deleteLocal(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := r.items[key]; ok {
+			r.removeElement(elem)
+		}
+	}
+}
+
+func (r *CacheRepo) removeElement(elem *list.Element) {
+	r.order.Remove(elem)
+	delete(r.items, elem.Value.(*entry).key)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,130 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository/memory"
+)
+
+type countingCache struct {
+	data map[string]string
+	gets int
+}
+
+func (c *countingCache) Get(_ context.Context, key string) (string, error) {
+	c.gets++
+	return c.data[key], nil
+}
+
+func (c *countingCache) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	c.data[key] = value.(string)
+	return nil
+}
+
+func (c *countingCache) SetMany(_ context.Context, items []entity.CacheItem) error {
+	for _, item := range items {
+		c.data[item.Key] = string(item.Value)
+	}
+	return nil
+}
+
+func (c *countingCache) Keys(_ context.Context, _ string) ([]string, error) {
+	keys := make([]string, 0, len(c.data))
+	for key := range c.data {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (c *countingCache) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(c.data, key)
+	}
+	return nil
+}
+
+func TestCacheRepoServesHotKeysLocally(t *testing.T) {
+	ctx := context.Background()
+	next := &countingCache{data: map[string]string{"a": "1"}}
+	cache := memory.NewCacheRepo(next, 2, time.Minute)
+
+	for range 3 {
+		value, err := cache.Get(ctx, "a")
+		if err != nil || value != "1" {
+			t.Fatalf("Get = %q, %v; want 1, nil", value, err)
+		}
+	}
+
+	if next.gets != 1 {
+		t.Errorf("next cache gets = %d, want 1", next.gets)
+	}
+}
+
+func TestCacheRepoEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	next := &countingCache{data: map[string]string{}}
+	cache := memory.NewCacheRepo(next, 2, time.Minute)
+
+	_ = cache.Set(ctx, "a", "1", 0)
+	_ = cache.Set(ctx, "b", "2", 0)
+	_, _ = cache.Get(ctx, "a")
+	_ = cache.Set(ctx, "c", "3", 0)
+
+	next.gets = 0
+	for _, key := range []string{"a", "c"} {
+		_, _ = cache.Get(ctx, key)
+	}
+	if next.gets != 0 {
+		t.Errorf("recently used keys fell through to next cache %d times", next.gets)
+	}
+
+	_, _ = cache.Get(ctx, "b")
+	if next.gets != 1 {
+		t.Errorf("evicted key was served locally")
+	}
+}
+
+func TestCacheRepoHonorsShorterExpiration(t *testing.T) {
+	ctx := context.Background()
+	next := &countingCache{data: map[string]string{}}
+	cache := memory.NewCacheRepo(next, 2, time.Minute)
+
+	_ = cache.Set(ctx, "a", "1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	_, _ = cache.Get(ctx, "a")
+	if next.gets != 1 {
+		t.Errorf("expired key was served locally")
+	}
+}
+
+func TestCacheRepoDeleteEvictsLocalCopy(t *testing.T) {
+	ctx := context.Background()
+	next := &countingCache{data: map[string]string{}}
+	cache := memory.NewCacheRepo(next, 2, time.Minute)
+
+	_ = cache.Set(ctx, "a", "1", 0)
+	_ = cache.Delete(ctx, "a")
+
+	value, _ := cache.Get(ctx, "a")
+	if value != "" {
+		t.Errorf("Get after Delete = %q, want empty", value)
+	}
+}
+
+func TestCacheRepoSetManyReplacesLocalCopies(t *testing.T) {
+	ctx := context.Background()
+	next := &countingCache{data: map[string]string{}}
+	cache := memory.NewCacheRepo(next, 2, time.Minute)
+
+	_ = cache.Set(ctx, "a", "1", 0)
+	_ = cache.SetMany(ctx, []entity.CacheItem{{Key: "a", Value: []byte("2")}})
+
+	value, err := cache.Get(ctx, "a")
+	if err != nil || value != "2" {
+		t.Errorf("Get = %q, %v; want 2, nil", value, err)
+	}
+}
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+const _apiKeyColumns = "id, name, role, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+type APIKeyRepo struct {
+	*postgres.Postgres
+	l *zerolog.Logger
+}
+
+func NewAPIKeyRepo(pg *postgres.Postgres, l *zerolog.Logger) *APIKeyRepo {
+	return &APIKeyRepo{
+		Postgres: pg,
+		l:        l,
+	}
+}
+
+func scanAPIKey(row pgx.Row) (*entity.APIKey, error) {
+	var key entity.APIKey
+	err := row.Scan(
+		&key.ID, &key.Name, &key.Role, &key.CreatedBy, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt,
+	)
+	return &key, err
+}
+
+func (r *APIKeyRepo) CreateAPIKey(ctx context.Context, key *entity.APIKey, keyHash string) (int, error) {
+	defer observeQuery("APIKeyRepo.CreateAPIKey", time.Now())
+
+	sql, args, _ := r.Builder.
+		Insert("api_keys").
+		Columns("name", "key_hash", "role", "created_by", "created_at", "expires_at").
+		Values(key.Name, keyHash, key.Role, key.CreatedBy, key.CreatedAt, key.ExpiresAt).
+		Suffix("RETURNING id").
+		ToSql()
+
+	var id int
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("APIKeyRepo.CreateAPIKey - r.Pool.QueryRow: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *APIKeyRepo) GetAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	defer observeQuery("APIKeyRepo.GetAPIKeys", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select(_apiKeyColumns).
+		From("api_keys").
+		OrderBy("id").
+		ToSql()
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("APIKeyRepo.GetAPIKeys - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []entity.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("APIKeyRepo.GetAPIKeys - rows.Scan: %w", err)
+		}
+
+		keys = append(keys, *key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("APIKeyRepo.GetAPIKeys - rows.Err: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (*entity.APIKey, error) {
+	defer observeQuery("APIKeyRepo.GetAPIKeyByHash", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select(_apiKeyColumns).
+		From("api_keys").
+		Where(squirrel.Eq{"key_hash": keyHash}).
+		ToSql()
+
+	key, err := scanAPIKey(r.Pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("APIKeyRepo.GetAPIKeyByHash - r.Pool.QueryRow.Scan: %w", err)
+	}
+
+	return key, nil
+}
+
+// TouchAPIKey sets the last-used time of a key to usedAt, unless it was already used within every.
+// Keys used on every request are then written at most once per every.
+func (r *APIKeyRepo) TouchAPIKey(ctx context.Context, id int, usedAt time.Time, every time.Duration) error {
+	defer observeQuery("APIKeyRepo.TouchAPIKey", time.Now())
+
+	sql, args, _ := r.Builder.
+		Update("api_keys").
+		Set("last_used_at", usedAt).
+		Where(squirrel.Eq{"id": id}).
+		Where(squirrel.Or{
+			squirrel.Eq{"last_used_at": nil},
+			squirrel.Lt{"last_used_at": usedAt.Add(-every)},
+		}).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("APIKeyRepo.TouchAPIKey - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepo) RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time) error {
+	defer observeQuery("APIKeyRepo.RevokeAPIKey", time.Now())
+
+	sql, args, _ := r.Builder.
+		Update("api_keys").
+		Set("revoked_at", revokedAt).
+		Where(squirrel.Eq{"id": id, "revoked_at": nil}).
+		ToSql()
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("APIKeyRepo.RevokeAPIKey - r.Pool.Exec: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
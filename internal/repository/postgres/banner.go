@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/realPointer/banners/internal/entity"
 	"github.com/realPointer/banners/pkg/postgres"
 	"github.com/rs/zerolog"
@@ -25,43 +28,121 @@ func NewBannerRepo(pg *postgres.Postgres, l *zerolog.Logger) *BannerRepo {
 	}
 }
 
-var ErrBannerNotFound = errors.New("banner not found")
+// _variantsSelect aggregates the variants of banner version bv into a JSON array.
+const _variantsSelect = "COALESCE((SELECT json_agg(json_build_object('name', v.name, 'weight', v.weight, 'content', v.content) " +
+	"ORDER BY v.name) FROM banner_variants v WHERE v.banner_id = bv.banner_id AND v.version = bv.version), '[]') AS variants"
 
-func (r *BannerRepo) GetBanner(ctx context.Context, tagID, featureID int) (string, error) {
-	sql, args, _ := r.Builder.
-		Select("bv.content").
+// _cacheTTLJoin joins the cache TTL override of the feature a banner is served for.
+const _cacheTTLJoin = "feature_cache_ttls fct ON fct.feature_id = ftb.feature_id"
+
+// cacheTTL converts a TTL override read with _cacheTTLJoin.
+func cacheTTL(seconds *int) *time.Duration {
+	if seconds == nil {
+		return nil
+	}
+
+	ttl := time.Duration(*seconds) * time.Second
+	return &ttl
+}
+
+var (
+	ErrBannerNotFound        = errors.New("banner not found")
+	ErrBannerVersionNotFound = errors.New("banner version not found")
+	ErrBannerConflict        = errors.New("banner with this feature and tag already exists")
+	ErrInvalidActiveWindow   = errors.New("active_until must be after active_from")
+)
+
+func (r *BannerRepo) GetBanner(ctx context.Context, tagID, featureID int, version *int) (*entity.UserBanner, error) {
+	defer observeQuery("BannerRepo.GetBanner", time.Now())
+
+	query := r.Builder.
+		Select("b.id", "bv.content", _variantsSelect, "b.active_until", "fct.ttl_seconds").
 		From("banners b").
 		Join("feature_tag_banners ftb ON b.id = ftb.banner_id").
 		Join("banner_versions bv ON b.id = bv.banner_id").
+		LeftJoin(_cacheTTLJoin).
 		Where(squirrel.Eq{
 			"ftb.tag_id":     tagID,
 			"ftb.feature_id": featureID,
 			"b.deleted":      false,
 			"b.is_active":    true,
 		}).
-		Where("bv.version = b.last_version").
-		ToSql()
+		Where("(b.active_from IS NULL OR b.active_from <= NOW())").
+		Where("(b.active_until IS NULL OR b.active_until > NOW())")
+
+	if version != nil {
+		query = query.Where(squirrel.Eq{"bv.version": *version})
+	} else {
+		query = query.Where("bv.version = COALESCE(b.pinned_version, b.last_version)")
+	}
 
-	var content string
-	err := r.Pool.QueryRow(ctx, sql, args...).Scan(&content)
+	sql, args, _ := query.ToSql()
+
+	var (
+		banner     entity.UserBanner
+		ttlSeconds *int
+	)
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(
+		&banner.BannerID, &banner.Content, &banner.Variants, &banner.ActiveUntil, &ttlSeconds,
+	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return "", ErrBannerNotFound
+			return nil, ErrBannerNotFound
 		}
-		return "", fmt.Errorf("BannerRepo.GetBanner - r.Pool.QueryRow: %w", err)
+		return nil, fmt.Errorf("BannerRepo.GetBanner - r.Pool.QueryRow: %w", err)
 	}
+	banner.CacheTTL = cacheTTL(ttlSeconds)
 
-	return content, nil
+	return &banner, nil
 }
 
-func (r *BannerRepo) GetBanners(ctx context.Context, featureID, tagID, limit, offset *int) ([]entity.BannerInfo, error) {
+// GetNextActivation returns when the banner of a feature/tag pair that is scheduled but not yet
+// active starts to be shown, or nil when the pair has no such banner.
+func (r *BannerRepo) GetNextActivation(ctx context.Context, tagID, featureID int) (*time.Time, error) {
+	defer observeQuery("BannerRepo.GetNextActivation", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select("MIN(b.active_from)").
+		From("banners b").
+		Join("feature_tag_banners ftb ON b.id = ftb.banner_id").
+		Where(squirrel.Eq{
+			"ftb.tag_id":     tagID,
+			"ftb.feature_id": featureID,
+			"b.deleted":      false,
+			"b.is_active":    true,
+		}).
+		Where("b.active_from > NOW()").
+		ToSql()
+
+	var activeFrom *time.Time
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(&activeFrom)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetNextActivation - r.Pool.QueryRow: %w", err)
+	}
+
+	return activeFrom, nil
+}
+
+func (r *BannerRepo) GetBanners(ctx context.Context, featureID, tagID, limit, offset *int, deleted bool) ([]entity.BannerInfo, error) {
+	defer observeQuery("BannerRepo.GetBanners", time.Now())
+
 	query := r.Builder.
-		Select("b.id as banner_id", "b.is_active", "b.created_at", "b.updated_at", "ftb.feature_id", "array_agg(ftb.tag_id ORDER BY ftb.tag_id ASC) as tag_ids", "bv.content").
+		Select(
+			"b.id as banner_id", "b.is_active", "b.pinned_version", "b.active_from", "b.active_until",
+			"b.created_at", "b.updated_at", "b.deleted_at", "b.deleted_by", "ftb.feature_id",
+			"array_agg(ftb.tag_id ORDER BY ftb.tag_id ASC) as tag_ids", "bv.content", _variantsSelect,
+		).
 		From("banners b").
 		Join("feature_tag_banners ftb ON b.id = ftb.banner_id").
 		Join("banner_versions bv ON b.id = bv.banner_id").
 		Where("bv.version = b.last_version").
-		GroupBy("b.id", "b.is_active", "b.created_at", "b.updated_at", "ftb.feature_id", "bv.content")
+		Where(squirrel.Eq{"b.deleted": deleted}).
+		// _variantsSelect reads bv.banner_id and bv.version, so they are grouped by as well.
+		GroupBy(
+			"b.id", "b.is_active", "b.pinned_version", "b.active_from", "b.active_until",
+			"b.created_at", "b.updated_at", "b.deleted_at", "b.deleted_by", "ftb.feature_id",
+			"bv.banner_id", "bv.version", "bv.content",
+		)
 
 	if featureID != nil {
 		query = query.Where(squirrel.Eq{"ftb.feature_id": *featureID})
@@ -94,7 +175,11 @@ func (r *BannerRepo) GetBanners(ctx context.Context, featureID, tagID, limit, of
 	for rows.Next() {
 		var banner entity.BannerInfo
 
-		err := rows.Scan(&banner.BannerID, &banner.IsActive, &banner.CreatedAt, &banner.UpdatedAt, &banner.FeatureID, &banner.TagIDs, &banner.Content)
+		err := rows.Scan(
+			&banner.BannerID, &banner.IsActive, &banner.PinnedVersion, &banner.ActiveFrom, &banner.ActiveUntil,
+			&banner.CreatedAt, &banner.UpdatedAt, &banner.DeletedAt, &banner.DeletedBy, &banner.FeatureID,
+			&banner.TagIDs, &banner.Content, &banner.Variants,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("BannerRepo.GetBanners - rows.Scan: %w", err)
 		}
@@ -109,7 +194,12 @@ func (r *BannerRepo) GetBanners(ctx context.Context, featureID, tagID, limit, of
 	return banners, nil
 }
 
-func (r *BannerRepo) CreateBanner(ctx context.Context, tagIDs []int, featureID int, content json.RawMessage, isActive bool) (int, error) {
+func (r *BannerRepo) CreateBanner(
+	ctx context.Context, tagIDs []int, featureID int, content json.RawMessage, variants []entity.BannerVariant, isActive bool,
+	activeFrom, activeUntil *time.Time,
+) (int, error) {
+	defer observeQuery("BannerRepo.CreateBanner", time.Now())
+
 	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("BannerRepo.CreateBanner - r.Pool.Begin: %w", err)
@@ -118,8 +208,8 @@ func (r *BannerRepo) CreateBanner(ctx context.Context, tagIDs []int, featureID i
 
 	sqlInsertBanner, argsInsertBanner, _ := r.Builder.
 		Insert("banners").
-		Columns("is_active").
-		Values(isActive).
+		Columns("is_active", "active_from", "active_until").
+		Values(isActive, activeFrom, activeUntil).
 		Suffix("RETURNING id").
 		ToSql()
 
@@ -153,6 +243,11 @@ func (r *BannerRepo) CreateBanner(ctx context.Context, tagIDs []int, featureID i
 		}
 	}
 
+	err = r.insertVariants(ctx, tx, bannerID, 1, variants)
+	if err != nil {
+		return 0, fmt.Errorf("BannerRepo.CreateBanner - r.insertVariants: %w", err)
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("BannerRepo.CreateBanner - tx.Commit: %w", err)
@@ -161,32 +256,75 @@ func (r *BannerRepo) CreateBanner(ctx context.Context, tagIDs []int, featureID i
 	return bannerID, nil
 }
 
-func (r *BannerRepo) UpdateBanner(ctx context.Context, bannerID int, tagIDs []int, featureID *int, content json.RawMessage, isActive *bool) error {
+func (r *BannerRepo) UpdateBanner(
+	ctx context.Context, bannerID int, tagIDs []int, featureID *int, content json.RawMessage, variants []entity.BannerVariant,
+	isActive *bool, activeFrom, activeUntil entity.NullableTime,
+) error {
+	defer observeQuery("BannerRepo.UpdateBanner", time.Now())
+
 	tx, err := r.Pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("BannerRepo.UpdateBanner - begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var lastVersion int
+	var maxVersion int
 	var newVersion int
 
-	if content != nil {
-		sqlGetLastVersion, argsGetLastVersion, _ := r.Builder.Select("last_version").From("banners").Where(squirrel.Eq{"id": bannerID}).ToSql()
-		err = tx.QueryRow(ctx, sqlGetLastVersion, argsGetLastVersion...).Scan(&lastVersion)
+	// A version is a snapshot of the content together with the variants, so changing either
+	// creates one. The part that is not changed is copied from the current version.
+	newRevision := content != nil || variants != nil
+
+	if newRevision {
+		// last_version may point at an older revision after a rollback, so the
+		// next version number is taken from the full history instead.
+		sqlGetMaxVersion, argsGetMaxVersion, _ := r.Builder.
+			Select("COALESCE(MAX(version), 0)").
+			From("banner_versions").
+			Where(squirrel.Eq{"banner_id": bannerID}).
+			ToSql()
+		err = tx.QueryRow(ctx, sqlGetMaxVersion, argsGetMaxVersion...).Scan(&maxVersion)
 		if err != nil {
-			return fmt.Errorf("BannerRepo.UpdateBanner - get last_version: %w", err)
+			return fmt.Errorf("BannerRepo.UpdateBanner - get max version: %w", err)
+		}
+		newVersion = maxVersion + 1
+
+		const whereCurrentVersion = "banner_id = ? AND version = (SELECT last_version FROM banners WHERE id = ?)"
+
+		insertBannerVersion := r.Builder.Insert("banner_versions").Columns("banner_id", "version", "content")
+		if content != nil {
+			insertBannerVersion = insertBannerVersion.Values(bannerID, newVersion, content)
+		} else {
+			insertBannerVersion = insertBannerVersion.Select(r.Builder.
+				Select("banner_id", fmt.Sprint(newVersion), "content").
+				From("banner_versions").
+				Where(whereCurrentVersion, bannerID, bannerID))
 		}
-		newVersion = lastVersion + 1
 
-		sqlInsertBannerVersion, argsInsertBannerVersion, _ := r.Builder.Insert("banner_versions").
-			Columns("banner_id", "version", "content").
-			Values(bannerID, newVersion, content).
-			ToSql()
+		sqlInsertBannerVersion, argsInsertBannerVersion, _ := insertBannerVersion.ToSql()
 		_, err = tx.Exec(ctx, sqlInsertBannerVersion, argsInsertBannerVersion...)
 		if err != nil {
 			return fmt.Errorf("BannerRepo.UpdateBanner - insert banner_versions: %w", err)
 		}
+
+		if variants != nil {
+			err = r.insertVariants(ctx, tx, bannerID, newVersion, variants)
+			if err != nil {
+				return fmt.Errorf("BannerRepo.UpdateBanner - r.insertVariants: %w", err)
+			}
+		} else {
+			sqlCopyVariants, argsCopyVariants, _ := r.Builder.Insert("banner_variants").
+				Columns("banner_id", "version", "name", "weight", "content").
+				Select(r.Builder.
+					Select("banner_id", fmt.Sprint(newVersion), "name", "weight", "content").
+					From("banner_variants").
+					Where(whereCurrentVersion, bannerID, bannerID)).
+				ToSql()
+			_, err = tx.Exec(ctx, sqlCopyVariants, argsCopyVariants...)
+			if err != nil {
+				return fmt.Errorf("BannerRepo.UpdateBanner - copy banner_variants: %w", err)
+			}
+		}
 	}
 
 	var currentFeatureID int
@@ -205,8 +343,8 @@ func (r *BannerRepo) UpdateBanner(ctx context.Context, bannerID int, tagIDs []in
 
 		for _, tagID := range tagIDs {
 			sqlInsertFeatureTag, argsInsertFeatureTag, _ := r.Builder.Insert("feature_tag_banners").
-				Columns("banner_id", "feature_id", "tag_id").
-				Values(bannerID, currentFeatureID, tagID).
+				Columns("banner_id", "feature_id", "tag_id", "deleted").
+				Values(bannerID, currentFeatureID, tagID, squirrel.Expr("(SELECT deleted FROM banners WHERE id = ?)", bannerID)).
 				ToSql()
 			_, err = tx.Exec(ctx, sqlInsertFeatureTag, argsInsertFeatureTag...)
 			if err != nil {
@@ -232,18 +370,38 @@ func (r *BannerRepo) UpdateBanner(ctx context.Context, bannerID int, tagIDs []in
 		updateBannerQuery = updateBannerQuery.Set("is_active", *isActive)
 	}
 
-	if content != nil {
+	if newRevision {
 		updateBannerQuery = updateBannerQuery.Set("last_version", newVersion)
 	}
 
-	updateBannerQuery = updateBannerQuery.Set("updated_at", squirrel.Expr("NOW()"))
+	if activeFrom.Set {
+		updateBannerQuery = updateBannerQuery.Set("active_from", activeFrom.Time)
+	}
+
+	if activeUntil.Set {
+		updateBannerQuery = updateBannerQuery.Set("active_until", activeUntil.Time)
+	}
+
+	updateBannerQuery = updateBannerQuery.
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Suffix("RETURNING active_from, active_until")
 
+	// An update may change only one bound of the activation window, so the window is
+	// checked as stored and the transaction is rolled back when it ends up inverted.
+	var storedFrom, storedUntil *time.Time
 	sqlUpdateBanner, argsUpdateBanner, _ := updateBannerQuery.ToSql()
-	_, err = tx.Exec(ctx, sqlUpdateBanner, argsUpdateBanner...)
+	err = tx.QueryRow(ctx, sqlUpdateBanner, argsUpdateBanner...).Scan(&storedFrom, &storedUntil)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrBannerNotFound
+		}
 		return fmt.Errorf("BannerRepo.UpdateBanner - update banners: %w", err)
 	}
 
+	if storedFrom != nil && storedUntil != nil && !storedUntil.After(*storedFrom) {
+		return ErrInvalidActiveWindow
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return fmt.Errorf("BannerRepo.UpdateBanner - commit transaction: %w", err)
@@ -252,46 +410,542 @@ func (r *BannerRepo) UpdateBanner(ctx context.Context, bannerID int, tagIDs []in
 	return nil
 }
 
-func (r *BannerRepo) DeleteBanner(ctx context.Context, bannerID int) error {
-	sql, args, _ := r.Builder.
-		Delete("banners").
-		Where(squirrel.Eq{"id": bannerID}).
+// DeleteBanner moves the banner to the trash, or removes it permanently when hard is set.
+// A hard delete also applies to banners that are already in the trash.
+func (r *BannerRepo) DeleteBanner(ctx context.Context, bannerID int, deletedBy string, hard bool) error {
+	defer observeQuery("BannerRepo.DeleteBanner", time.Now())
+
+	if hard {
+		sql, args, _ := r.Builder.
+			Delete("banners").
+			Where(squirrel.Eq{"id": bannerID}).
+			ToSql()
+
+		tag, err := r.Pool.Exec(ctx, sql, args...)
+		if err != nil {
+			return fmt.Errorf("BannerRepo.DeleteBanner - r.Pool.Exec: %w", err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrBannerNotFound
+		}
+
+		return nil
+	}
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.DeleteBanner - begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sqlSoftDelete, argsSoftDelete, _ := r.Builder.
+		Update("banners").
+		Set("deleted", true).
+		Set("deleted_at", squirrel.Expr("NOW()")).
+		Set("deleted_by", deletedBy).
+		Where(squirrel.Eq{"id": bannerID, "deleted": false}).
 		ToSql()
 
-	_, err := r.Pool.Exec(ctx, sql, args...)
+	tag, err := tx.Exec(ctx, sqlSoftDelete, argsSoftDelete...)
 	if err != nil {
-		return fmt.Errorf("BannerRepo.DeleteBanner - r.Pool.Exec: %w", err)
+		return fmt.Errorf("BannerRepo.DeleteBanner - update banners: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrBannerNotFound
+	}
+
+	sqlUpdateFeatureTags, argsUpdateFeatureTags, _ := r.Builder.
+		Update("feature_tag_banners").
+		Set("deleted", true).
+		Where(squirrel.Eq{"banner_id": bannerID}).
+		ToSql()
+
+	_, err = tx.Exec(ctx, sqlUpdateFeatureTags, argsUpdateFeatureTags...)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.DeleteBanner - update feature_tag_banners: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.DeleteBanner - commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-func (r *BannerRepo) DeleteBannersByFeatureID(ctx context.Context, featureID int) error {
-	sql, args, _ := r.Builder.
-		Update("banners b").
+// bannersByFeatureOrTag selects the IDs of banners outside the trash linked to the given feature or tag.
+func (r *BannerRepo) bannersByFeatureOrTag(featureID, tagID *int) squirrel.SelectBuilder {
+	query := r.Builder.
+		Select("DISTINCT banner_id").
+		From("feature_tag_banners").
+		Where(squirrel.Eq{"deleted": false})
+
+	if featureID != nil {
+		query = query.Where(squirrel.Eq{"feature_id": *featureID})
+	}
+
+	if tagID != nil {
+		query = query.Where(squirrel.Eq{"tag_id": *tagID})
+	}
+
+	return query
+}
+
+func (r *BannerRepo) CountBanners(ctx context.Context, featureID, tagID *int) (int, error) {
+	defer observeQuery("BannerRepo.CountBanners", time.Now())
+
+	sql, args, err := r.Builder.
+		Select("COUNT(*)").
+		FromSelect(r.bannersByFeatureOrTag(featureID, tagID), "ftb").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("BannerRepo.CountBanners - query.ToSql: %w", err)
+	}
+
+	var count int
+	err = r.Pool.QueryRow(ctx, sql, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("BannerRepo.CountBanners - r.Pool.QueryRow: %w", err)
+	}
+
+	return count, nil
+}
+
+// SoftDeleteBannersBatch moves up to batchSize banners linked to the given feature or tag to the trash.
+func (r *BannerRepo) SoftDeleteBannersBatch(
+	ctx context.Context, featureID, tagID *int, deletedBy string, batchSize int,
+) ([]int, error) {
+	defer observeQuery("BannerRepo.SoftDeleteBannersBatch", time.Now())
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sqlSoftDelete, argsSoftDelete, err := r.Builder.
+		Update("banners").
+		Set("deleted", true).
+		Set("deleted_at", squirrel.Expr("NOW()")).
+		Set("deleted_by", deletedBy).
+		Where(r.bannersByFeatureOrTag(featureID, tagID).Prefix("id IN (").Suffix("LIMIT ?)", batchSize)).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - query.ToSql: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, sqlSoftDelete, argsSoftDelete...)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - update banners: %w", err)
+	}
+
+	bannerIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - pgx.CollectRows: %w", err)
+	}
+
+	if len(bannerIDs) == 0 {
+		return nil, nil
+	}
+
+	sqlUpdateFeatureTags, argsUpdateFeatureTags, _ := r.Builder.
+		Update("feature_tag_banners").
 		Set("deleted", true).
-		Where("b.id IN (SELECT banner_id FROM feature_tag_banners WHERE feature_id = $2)", featureID).
+		Where(squirrel.Eq{"banner_id": bannerIDs}).
+		ToSql()
+
+	_, err = tx.Exec(ctx, sqlUpdateFeatureTags, argsUpdateFeatureTags...)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - update feature_tag_banners: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.SoftDeleteBannersBatch - commit transaction: %w", err)
+	}
+
+	return bannerIDs, nil
+}
+
+func (r *BannerRepo) RestoreBanner(ctx context.Context, bannerID int) error {
+	defer observeQuery("BannerRepo.RestoreBanner", time.Now())
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RestoreBanner - begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sqlGetBanner, argsGetBanner, _ := r.Builder.
+		Select("id").
+		From("banners").
+		Where(squirrel.Eq{"id": bannerID, "deleted": true}).
+		Suffix("FOR UPDATE").
+		ToSql()
+
+	var id int
+	err = tx.QueryRow(ctx, sqlGetBanner, argsGetBanner...).Scan(&id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrBannerNotFound
+		}
+		return fmt.Errorf("BannerRepo.RestoreBanner - get banner: %w", err)
+	}
+
+	sqlConflict, argsConflict, _ := r.Builder.
+		Select("1").
+		From("feature_tag_banners ftb").
+		Join("feature_tag_banners other ON other.feature_id = ftb.feature_id AND other.tag_id = ftb.tag_id").
+		Where(squirrel.Eq{"ftb.banner_id": bannerID, "other.deleted": false}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
 		ToSql()
 
-	_, err := r.Pool.Exec(ctx, sql, args...)
+	var conflict bool
+	err = tx.QueryRow(ctx, sqlConflict, argsConflict...).Scan(&conflict)
 	if err != nil {
-		return fmt.Errorf("BannerRepo.DeleteBannersByFeatureID - update banners: %w", err)
+		return fmt.Errorf("BannerRepo.RestoreBanner - check feature_tag_banners: %w", err)
+	}
+
+	if conflict {
+		return ErrBannerConflict
+	}
+
+	sqlRestoreBanner, argsRestoreBanner, _ := r.Builder.
+		Update("banners").
+		Set("deleted", false).
+		Set("deleted_at", nil).
+		Set("deleted_by", nil).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": bannerID}).
+		ToSql()
+
+	_, err = tx.Exec(ctx, sqlRestoreBanner, argsRestoreBanner...)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RestoreBanner - update banners: %w", err)
+	}
+
+	sqlRestoreFeatureTags, argsRestoreFeatureTags, _ := r.Builder.
+		Update("feature_tag_banners").
+		Set("deleted", false).
+		Where(squirrel.Eq{"banner_id": bannerID}).
+		ToSql()
+
+	_, err = tx.Exec(ctx, sqlRestoreFeatureTags, argsRestoreFeatureTags...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrBannerConflict
+		}
+		return fmt.Errorf("BannerRepo.RestoreBanner - update feature_tag_banners: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RestoreBanner - commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-func (r *BannerRepo) DeleteBannersByTagID(ctx context.Context, tagID int) error {
+// PurgeDeletedBanners permanently removes up to batchSize banners that have been in the trash
+// for longer than retention, together with their versions, tags and variants.
+func (r *BannerRepo) PurgeDeletedBanners(ctx context.Context, retention time.Duration, batchSize int) (int, error) {
+	defer observeQuery("BannerRepo.PurgeDeletedBanners", time.Now())
+
+	expired := r.Builder.
+		Select("id").
+		From("banners").
+		Where(squirrel.Eq{"deleted": true}).
+		Where("deleted_at < NOW() - ? * INTERVAL '1 second'", retention.Seconds()).
+		Limit(uint64(batchSize))
+
+	sql, args, err := r.Builder.
+		Delete("banners").
+		Where(expired.Prefix("id IN (").Suffix(")")).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("BannerRepo.PurgeDeletedBanners - query.ToSql: %w", err)
+	}
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("BannerRepo.PurgeDeletedBanners - r.Pool.Exec: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *BannerRepo) GetBannerVersions(ctx context.Context, bannerID int) ([]entity.BannerVersion, error) {
+	defer observeQuery("BannerRepo.GetBannerVersions", time.Now())
+
 	sql, args, _ := r.Builder.
-		Update("banners b").
-		Set("deleted", true).
-		Where("b.id IN (SELECT banner_id FROM feature_tag_banners WHERE tag_id = $2)", tagID).
+		Select("bv.version", "bv.content", _variantsSelect, "bv.created_at").
+		From("banner_versions bv").
+		Where(squirrel.Eq{"bv.banner_id": bannerID}).
+		OrderBy("bv.version ASC").
+		ToSql()
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetBannerVersions - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []entity.BannerVersion
+	for rows.Next() {
+		var version entity.BannerVersion
+
+		err := rows.Scan(&version.Version, &version.Content, &version.Variants, &version.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("BannerRepo.GetBannerVersions - rows.Scan: %w", err)
+		}
+
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetBannerVersions - rows.Err: %w", err)
+	}
+
+	// Every banner is created together with its first version.
+	if len(versions) == 0 {
+		return nil, ErrBannerNotFound
+	}
+
+	return versions, nil
+}
+
+func (r *BannerRepo) GetBannerVersion(ctx context.Context, bannerID, version int) (*entity.BannerVersion, error) {
+	defer observeQuery("BannerRepo.GetBannerVersion", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select("bv.version", "bv.content", _variantsSelect, "bv.created_at").
+		From("banner_versions bv").
+		Where(squirrel.Eq{
+			"bv.banner_id": bannerID,
+			"bv.version":   version,
+		}).
+		ToSql()
+
+	var bannerVersion entity.BannerVersion
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(
+		&bannerVersion.Version, &bannerVersion.Content, &bannerVersion.Variants, &bannerVersion.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrBannerVersionNotFound
+		}
+		return nil, fmt.Errorf("BannerRepo.GetBannerVersion - r.Pool.QueryRow: %w", err)
+	}
+
+	return &bannerVersion, nil
+}
+
+func (r *BannerRepo) RollbackBanner(ctx context.Context, bannerID, version int) error {
+	defer observeQuery("BannerRepo.RollbackBanner", time.Now())
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RollbackBanner - begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sqlGetBanner, argsGetBanner, _ := r.Builder.
+		Select("id").
+		From("banners").
+		Where(squirrel.Eq{"id": bannerID}).
+		Suffix("FOR UPDATE").
+		ToSql()
+
+	var id int
+	err = tx.QueryRow(ctx, sqlGetBanner, argsGetBanner...).Scan(&id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrBannerNotFound
+		}
+		return fmt.Errorf("BannerRepo.RollbackBanner - get banner: %w", err)
+	}
+
+	sqlUpdateBanner, argsUpdateBanner, _ := r.Builder.
+		Update("banners").
+		Set("last_version", version).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": bannerID}).
+		Where("EXISTS (SELECT 1 FROM banner_versions WHERE banner_id = ? AND version = ?)", bannerID, version).
 		ToSql()
 
-	_, err := r.Pool.Exec(ctx, sql, args...)
+	tag, err := tx.Exec(ctx, sqlUpdateBanner, argsUpdateBanner...)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RollbackBanner - update banners: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrBannerVersionNotFound
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.RollbackBanner - commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BannerRepo) SetPinnedVersion(ctx context.Context, bannerID int, version *int) error {
+	defer observeQuery("BannerRepo.SetPinnedVersion", time.Now())
+
+	query := r.Builder.
+		Update("banners").
+		Set("pinned_version", version).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": bannerID})
+
+	if version != nil {
+		query = query.Where("EXISTS (SELECT 1 FROM banner_versions WHERE banner_id = ? AND version = ?)", bannerID, *version)
+	}
+
+	sql, args, _ := query.ToSql()
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("BannerRepo.SetPinnedVersion - r.Pool.Exec: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		if version != nil {
+			return ErrBannerVersionNotFound
+		}
+		return ErrBannerNotFound
+	}
+
+	return nil
+}
+
+func (r *BannerRepo) insertVariants(
+	ctx context.Context, tx pgx.Tx, bannerID, version int, variants []entity.BannerVariant,
+) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	query := r.Builder.
+		Insert("banner_variants").
+		Columns("banner_id", "version", "name", "weight", "content")
+
+	for _, variant := range variants {
+		query = query.Values(bannerID, version, variant.Name, variant.Weight, variant.Content)
+	}
+
+	sql, args, _ := query.ToSql()
+
+	_, err := tx.Exec(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("BannerRepo.DeleteBannersByTagID - update banners: %w", err)
+		return fmt.Errorf("insert banner_variants: %w", err)
 	}
 
 	return nil
 }
+
+// GetFeatureTags returns the feature/tag pairs of the given banners, including banners in the trash.
+func (r *BannerRepo) GetFeatureTags(ctx context.Context, bannerIDs []int) ([]entity.FeatureTag, error) {
+	defer observeQuery("BannerRepo.GetFeatureTags", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select("ftb.feature_id", "ftb.tag_id").
+		From("feature_tag_banners ftb").
+		Where(squirrel.Eq{"ftb.banner_id": bannerIDs}).
+		ToSql()
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetFeatureTags - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var featureTags []entity.FeatureTag
+	for rows.Next() {
+		var featureTag entity.FeatureTag
+
+		err := rows.Scan(&featureTag.FeatureID, &featureTag.TagID)
+		if err != nil {
+			return nil, fmt.Errorf("BannerRepo.GetFeatureTags - rows.Scan: %w", err)
+		}
+
+		featureTags = append(featureTags, featureTag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetFeatureTags - rows.Err: %w", err)
+	}
+
+	return featureTags, nil
+}
+
+// GetActiveBanners returns up to limit banners that users currently see, one per feature/tag pair,
+// ordered by feature and tag. Only pairs after the given one are returned, so callers page with the
+// last pair of the previous call.
+func (r *BannerRepo) GetActiveBanners(ctx context.Context, after *entity.FeatureTag, limit int) ([]entity.ActiveBanner, error) {
+	defer observeQuery("BannerRepo.GetActiveBanners", time.Now())
+
+	query := r.Builder.
+		Select(
+			"ftb.feature_id", "ftb.tag_id", "b.id", "bv.content", _variantsSelect, "b.active_until", "fct.ttl_seconds",
+		).
+		From("banners b").
+		Join("feature_tag_banners ftb ON b.id = ftb.banner_id").
+		Join("banner_versions bv ON b.id = bv.banner_id").
+		LeftJoin(_cacheTTLJoin).
+		Where(squirrel.Eq{
+			"b.deleted":   false,
+			"b.is_active": true,
+		}).
+		Where("(b.active_from IS NULL OR b.active_from <= NOW())").
+		Where("(b.active_until IS NULL OR b.active_until > NOW())").
+		Where("bv.version = COALESCE(b.pinned_version, b.last_version)").
+		OrderBy("ftb.feature_id", "ftb.tag_id").
+		Limit(uint64(limit))
+
+	if after != nil {
+		query = query.Where("(ftb.feature_id, ftb.tag_id) > (?, ?)", after.FeatureID, after.TagID)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetActiveBanners - query.ToSql: %w", err)
+	}
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetActiveBanners - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var banners []entity.ActiveBanner
+	for rows.Next() {
+		var (
+			banner     entity.ActiveBanner
+			ttlSeconds *int
+		)
+
+		err := rows.Scan(
+			&banner.FeatureID, &banner.TagID, &banner.Banner.BannerID, &banner.Banner.Content,
+			&banner.Banner.Variants, &banner.Banner.ActiveUntil, &ttlSeconds,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("BannerRepo.GetActiveBanners - rows.Scan: %w", err)
+		}
+		banner.Banner.CacheTTL = cacheTTL(ttlSeconds)
+
+		banners = append(banners, banner)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("BannerRepo.GetActiveBanners - rows.Err: %w", err)
+	}
+
+	return banners, nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+// CachePolicyRepo stores the per-feature overrides of the banner cache TTL.
+type CachePolicyRepo struct {
+	*postgres.Postgres
+	l *zerolog.Logger
+}
+
+func NewCachePolicyRepo(pg *postgres.Postgres, l *zerolog.Logger) *CachePolicyRepo {
+	return &CachePolicyRepo{
+		Postgres: pg,
+		l:        l,
+	}
+}
+
+var ErrFeatureTTLNotFound = errors.New("feature cache ttl not found")
+
+func (r *CachePolicyRepo) GetFeatureTTLs(ctx context.Context) ([]entity.FeatureCacheTTL, error) {
+	defer observeQuery("CachePolicyRepo.GetFeatureTTLs", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select("feature_id", "ttl_seconds", "updated_at").
+		From("feature_cache_ttls").
+		OrderBy("feature_id").
+		ToSql()
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CachePolicyRepo.GetFeatureTTLs - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	ttls := []entity.FeatureCacheTTL{}
+	for rows.Next() {
+		var ttl entity.FeatureCacheTTL
+
+		err := rows.Scan(&ttl.FeatureID, &ttl.TTLSeconds, &ttl.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("CachePolicyRepo.GetFeatureTTLs - rows.Scan: %w", err)
+		}
+
+		ttls = append(ttls, ttl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("CachePolicyRepo.GetFeatureTTLs - rows.Err: %w", err)
+	}
+
+	return ttls, nil
+}
+
+func (r *CachePolicyRepo) SetFeatureTTL(ctx context.Context, featureID int, ttl time.Duration) error {
+	defer observeQuery("CachePolicyRepo.SetFeatureTTL", time.Now())
+
+	sql, args, _ := r.Builder.
+		Insert("feature_cache_ttls").
+		Columns("feature_id", "ttl_seconds").
+		Values(featureID, int(ttl.Seconds())).
+		Suffix("ON CONFLICT (feature_id) DO UPDATE SET ttl_seconds = EXCLUDED.ttl_seconds, updated_at = NOW()").
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("CachePolicyRepo.SetFeatureTTL - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+func (r *CachePolicyRepo) DeleteFeatureTTL(ctx context.Context, featureID int) error {
+	defer observeQuery("CachePolicyRepo.DeleteFeatureTTL", time.Now())
+
+	sql, args, _ := r.Builder.
+		Delete("feature_cache_ttls").
+		Where(squirrel.Eq{"feature_id": featureID}).
+		ToSql()
+
+	tag, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("CachePolicyRepo.DeleteFeatureTTL - r.Pool.Exec: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrFeatureTTLNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+type JobRepo struct {
+	*postgres.Postgres
+	l *zerolog.Logger
+}
+
+func NewJobRepo(pg *postgres.Postgres, l *zerolog.Logger) *JobRepo {
+	return &JobRepo{
+		Postgres: pg,
+		l:        l,
+	}
+}
+
+var ErrJobNotFound = errors.New("job not found")
+
+var _jobColumns = []string{
+	"id", "kind", "target_id", "status", "total", "processed", "error", "created_by", "created_at", "updated_at",
+}
+
+func scanJob(row pgx.Row) (*entity.Job, error) {
+	var job entity.Job
+	err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.TargetID,
+		&job.Status,
+		&job.Total,
+		&job.Processed,
+		&job.Error,
+		&job.CreatedBy,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (r *JobRepo) CreateJob(ctx context.Context, kind string, targetID int, createdBy string) (int, error) {
+	defer observeQuery("JobRepo.CreateJob", time.Now())
+
+	sql, args, _ := r.Builder.
+		Insert("jobs").
+		Columns("kind", "target_id", "created_by").
+		Values(kind, targetID, createdBy).
+		Suffix("RETURNING id").
+		ToSql()
+
+	var jobID int
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(&jobID)
+	if err != nil {
+		return 0, fmt.Errorf("JobRepo.CreateJob - r.Pool.QueryRow: %w", err)
+	}
+
+	return jobID, nil
+}
+
+func (r *JobRepo) GetJob(ctx context.Context, jobID int) (*entity.Job, error) {
+	defer observeQuery("JobRepo.GetJob", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select(_jobColumns...).
+		From("jobs").
+		Where(squirrel.Eq{"id": jobID}).
+		ToSql()
+
+	job, err := scanJob(r.Pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("JobRepo.GetJob - r.Pool.QueryRow: %w", err)
+	}
+
+	return job, nil
+}
+
+// AcquireJob marks the oldest pending job as running and returns it. Running jobs that have not
+// reported progress for staleAfter are picked up again, so a crashed worker does not leave them stuck.
+// It returns ErrJobNotFound when there is nothing to do.
+func (r *JobRepo) AcquireJob(ctx context.Context, staleAfter time.Duration) (*entity.Job, error) {
+	defer observeQuery("JobRepo.AcquireJob", time.Now())
+
+	next := r.Builder.
+		Select("id").
+		From("jobs").
+		Where(squirrel.Or{
+			squirrel.Eq{"status": entity.JobStatusPending},
+			squirrel.And{
+				squirrel.Eq{"status": entity.JobStatusRunning},
+				squirrel.Expr("updated_at < NOW() - ? * INTERVAL '1 second'", staleAfter.Seconds()),
+			},
+		}).
+		OrderBy("id ASC").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	sql, args, err := r.Builder.
+		Update("jobs").
+		Set("status", entity.JobStatusRunning).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(next.Prefix("id = (").Suffix(")")).
+		Suffix("RETURNING " + strings.Join(_jobColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("JobRepo.AcquireJob - query.ToSql: %w", err)
+	}
+
+	job, err := scanJob(r.Pool.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("JobRepo.AcquireJob - r.Pool.QueryRow: %w", err)
+	}
+
+	return job, nil
+}
+
+func (r *JobRepo) UpdateJobProgress(ctx context.Context, jobID, total, processed int) error {
+	defer observeQuery("JobRepo.UpdateJobProgress", time.Now())
+
+	sql, args, _ := r.Builder.
+		Update("jobs").
+		Set("total", total).
+		Set("processed", processed).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": jobID}).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("JobRepo.UpdateJobProgress - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+func (r *JobRepo) FinishJob(ctx context.Context, jobID int, jobErr error) error {
+	defer observeQuery("JobRepo.FinishJob", time.Now())
+
+	query := r.Builder.
+		Update("jobs").
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": jobID})
+
+	if jobErr != nil {
+		query = query.Set("status", entity.JobStatusFailed).Set("error", jobErr.Error())
+	} else {
+		query = query.Set("status", entity.JobStatusDone)
+	}
+
+	sql, args, _ := query.ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("JobRepo.FinishJob - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
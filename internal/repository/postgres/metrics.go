@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var _queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "banners",
+	Subsystem: "postgres",
+	Name:      "query_duration_seconds",
+	Help:      "Latency of repository methods, including every query they run.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+// observeQuery records the latency of a repository method. Call it deferred at the start of the method.
+func observeQuery(method string, start time.Time) {
+	_queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
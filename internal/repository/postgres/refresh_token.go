@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token already used")
+)
+
+// RefreshTokenRepo stores refresh tokens by their SHA-256 hash, never in plain text.
+type RefreshTokenRepo struct {
+	*postgres.Postgres
+	l *zerolog.Logger
+}
+
+func NewRefreshTokenRepo(pg *postgres.Postgres, l *zerolog.Logger) *RefreshTokenRepo {
+	return &RefreshTokenRepo{
+		Postgres: pg,
+		l:        l,
+	}
+}
+
+func (r *RefreshTokenRepo) CreateRefreshToken(
+	ctx context.Context, tokenHash string, token *entity.RefreshToken, ttl time.Duration,
+) error {
+	defer observeQuery("RefreshTokenRepo.CreateRefreshToken", time.Now())
+
+	sql, args, _ := r.Builder.
+		Insert("refresh_tokens").
+		Columns("token_hash", "family_id", "username", "expires_at").
+		Values(tokenHash, token.FamilyID, token.Username, squirrel.Expr("NOW() + make_interval(secs => ?)", ttl.Seconds())).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("RefreshTokenRepo.CreateRefreshToken - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// UseRefreshToken marks a live refresh token as used and returns it. A token can be used once:
+// using it again returns ErrRefreshTokenReused, which hints that it has leaked.
+func (r *RefreshTokenRepo) UseRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	defer observeQuery("RefreshTokenRepo.UseRefreshToken", time.Now())
+
+	sql, args, _ := r.Builder.
+		Update("refresh_tokens").
+		Set("used_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{
+			"token_hash": tokenHash,
+			"used_at":    nil,
+			"revoked_at": nil,
+		}).
+		Where("expires_at > NOW()").
+		Suffix("RETURNING family_id, username").
+		ToSql()
+
+	var token entity.RefreshToken
+	err := r.Pool.QueryRow(ctx, sql, args...).Scan(&token.FamilyID, &token.Username)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("RefreshTokenRepo.UseRefreshToken - update: %w", err)
+	}
+
+	sqlReused, argsReused, _ := r.Builder.
+		Select("1").
+		Prefix("SELECT EXISTS (").
+		From("refresh_tokens").
+		Where(squirrel.Eq{"token_hash": tokenHash, "revoked_at": nil}).
+		Where(squirrel.NotEq{"used_at": nil}).
+		Suffix(")").
+		ToSql()
+
+	var reused bool
+	err = r.Pool.QueryRow(ctx, sqlReused, argsReused...).Scan(&reused)
+	if err != nil {
+		return nil, fmt.Errorf("RefreshTokenRepo.UseRefreshToken - check reuse: %w", err)
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return nil, ErrRefreshTokenNotFound
+}
+
+// RevokeRefreshTokenFamily revokes the token with the given hash and every token rotated from
+// the same login. When username is not empty, nothing is revoked unless the token was issued to username.
+func (r *RefreshTokenRepo) RevokeRefreshTokenFamily(ctx context.Context, tokenHash, username string) error {
+	defer observeQuery("RefreshTokenRepo.RevokeRefreshTokenFamily", time.Now())
+
+	family := squirrel.Select("family_id").From("refresh_tokens").Where(squirrel.Eq{"token_hash": tokenHash})
+	if username != "" {
+		family = family.Where(squirrel.Eq{"username": username})
+	}
+	familySQL, familyArgs, _ := family.ToSql()
+
+	sql, args, _ := r.Builder.
+		Update("refresh_tokens").
+		Set("revoked_at", squirrel.Expr("NOW()")).
+		Where("family_id = ("+familySQL+")", familyArgs...).
+		Where(squirrel.Eq{"revoked_at": nil}).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("RefreshTokenRepo.RevokeRefreshTokenFamily - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredRefreshTokens deletes the refresh tokens past their expiry, whether used, revoked or not.
+// An expired token is rejected anyway, so dropping it loses nothing.
+func (r *RefreshTokenRepo) DeleteExpiredRefreshTokens(ctx context.Context) error {
+	defer observeQuery("RefreshTokenRepo.DeleteExpiredRefreshTokens", time.Now())
+
+	sql, args, _ := r.Builder.
+		Delete("refresh_tokens").
+		Where("expires_at < NOW()").
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("RefreshTokenRepo.DeleteExpiredRefreshTokens - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
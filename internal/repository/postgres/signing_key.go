@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/postgres"
+	"github.com/rs/zerolog"
+)
+
+type SigningKeyRepo struct {
+	*postgres.Postgres
+	l *zerolog.Logger
+}
+
+func NewSigningKeyRepo(pg *postgres.Postgres, l *zerolog.Logger) *SigningKeyRepo {
+	return &SigningKeyRepo{
+		Postgres: pg,
+		l:        l,
+	}
+}
+
+func (r *SigningKeyRepo) CreateSigningKey(ctx context.Context, key *entity.SigningKey) error {
+	defer observeQuery("SigningKeyRepo.CreateSigningKey", time.Now())
+
+	sql, args, _ := r.Builder.
+		Insert("signing_keys").
+		Columns("id", "algorithm", "private_key", "created_at", "expires_at").
+		Values(key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ExpiresAt).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("SigningKeyRepo.CreateSigningKey - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
+
+// GetSigningKeys returns the keys that expire after now, newest first.
+func (r *SigningKeyRepo) GetSigningKeys(ctx context.Context, now time.Time) ([]entity.SigningKey, error) {
+	defer observeQuery("SigningKeyRepo.GetSigningKeys", time.Now())
+
+	sql, args, _ := r.Builder.
+		Select("id", "algorithm", "private_key", "created_at", "expires_at").
+		From("signing_keys").
+		Where(squirrel.Gt{"expires_at": now}).
+		OrderBy("created_at DESC").
+		ToSql()
+
+	rows, err := r.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("SigningKeyRepo.GetSigningKeys - r.Pool.Query: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []entity.SigningKey
+	for rows.Next() {
+		var key entity.SigningKey
+
+		err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("SigningKeyRepo.GetSigningKeys - rows.Scan: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("SigningKeyRepo.GetSigningKeys - rows.Err: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *SigningKeyRepo) DeleteExpiredSigningKeys(ctx context.Context, now time.Time) error {
+	defer observeQuery("SigningKeyRepo.DeleteExpiredSigningKeys", time.Now())
+
+	sql, args, _ := r.Builder.
+		Delete("signing_keys").
+		Where(squirrel.LtOrEq{"expires_at": now}).
+		ToSql()
+
+	_, err := r.Pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("SigningKeyRepo.DeleteExpiredSigningKeys - r.Pool.Exec: %w", err)
+	}
+
+	return nil
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/realPointer/banners/internal/entity"
 	"github.com/realPointer/banners/pkg/postgres"
 	"github.com/rs/zerolog"
@@ -24,7 +27,17 @@ func NewUserRepo(pg *postgres.Postgres, l *zerolog.Logger) *UserRepo {
 	}
 }
 
+var (
+	ErrUserExists  = errors.New("user with this username already exists")
+	ErrAdminExists = errors.New("admin user already exists")
+)
+
+// _firstAdminLockID is the advisory lock key serializing CreateFirstAdmin calls.
+const _firstAdminLockID = 4242001
+
 func (r *UserRepo) CreateUser(ctx context.Context, user *entity.User) error {
+	defer observeQuery("UserRepo.CreateUser", time.Now())
+
 	sql, args, _ := r.Builder.
 		Insert("users").
 		Columns("username", "password", "role").
@@ -33,13 +46,73 @@ func (r *UserRepo) CreateUser(ctx context.Context, user *entity.User) error {
 
 	_, err := r.Pool.Exec(ctx, sql, args...)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrUserExists
+		}
 		return fmt.Errorf("UserRepo.Create - r.Pool.Exec: %w", err)
 	}
 
 	return nil
 }
 
+// CreateFirstAdmin creates user with the admin role unless an admin already exists.
+func (r *UserRepo) CreateFirstAdmin(ctx context.Context, user *entity.User) error {
+	defer observeQuery("UserRepo.CreateFirstAdmin", time.Now())
+
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("UserRepo.CreateFirstAdmin - r.Pool.Begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", _firstAdminLockID)
+	if err != nil {
+		return fmt.Errorf("UserRepo.CreateFirstAdmin - pg_advisory_xact_lock: %w", err)
+	}
+
+	sqlExists, argsExists, _ := r.Builder.
+		Select("1").
+		Prefix("SELECT EXISTS (").
+		From("users").
+		Where(squirrel.Eq{"role": entity.RoleAdmin}).
+		Suffix(")").
+		ToSql()
+
+	var exists bool
+	err = tx.QueryRow(ctx, sqlExists, argsExists...).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("UserRepo.CreateFirstAdmin - tx.QueryRow: %w", err)
+	}
+	if exists {
+		return ErrAdminExists
+	}
+
+	sqlInsert, argsInsert, _ := r.Builder.
+		Insert("users").
+		Columns("username", "password", "role").
+		Values(user.Username, user.Password, entity.RoleAdmin).
+		ToSql()
+
+	_, err = tx.Exec(ctx, sqlInsert, argsInsert...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrUserExists
+		}
+		return fmt.Errorf("UserRepo.CreateFirstAdmin - tx.Exec: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("UserRepo.CreateFirstAdmin - tx.Commit: %w", err)
+	}
+
+	return nil
+}
+
 func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	defer observeQuery("UserRepo.GetUserByUsername", time.Now())
+
 	sql, args, _ := r.Builder.
 		Select("username", "password", "role").
 		From("users").
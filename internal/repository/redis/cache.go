@@ -2,37 +2,120 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	redisv8 "github.com/go-redis/redis/v8"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/circuitbreaker"
 	"github.com/realPointer/banners/pkg/redis"
 )
 
+// _scanCount is the number of keys Redis inspects per SCAN call.
+const _scanCount = 1000
+
+// CacheRepo stores values in Redis under keys prefixed with prefix, so several environments can
+// share one Redis. Calls go through a circuit breaker, so while Redis is unavailable they fail
+// fast with circuitbreaker.ErrOpen instead of waiting for a timeout.
 type CacheRepo struct {
 	*redis.Redis
+	breaker *circuitbreaker.Breaker
+	prefix  string
 }
 
-func NewCacheRepo(rdb *redis.Redis) *CacheRepo {
+func NewCacheRepo(rdb *redis.Redis, breaker *circuitbreaker.Breaker, prefix string) *CacheRepo {
 	return &CacheRepo{
-		Redis: rdb,
+		Redis:   rdb,
+		breaker: breaker,
+		prefix:  prefix,
 	}
 }
 
+func (r *CacheRepo) key(key string) string {
+	return r.prefix + key
+}
+
 func (r *CacheRepo) Get(ctx context.Context, key string) (string, error) {
-	value, err := r.Client.Get(ctx, key).Result()
-	if err == redisv8.Nil {
-		return "", nil
-	} else if err != nil {
+	var value string
+	err := r.breaker.Do(func() error {
+		var err error
+		value, err = r.Client.Get(ctx, r.key(key)).Result()
+		if errors.Is(err, redisv8.Nil) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
 		return "", fmt.Errorf("redis - Get - r.Client.Get: %w", err)
 	}
 	return value, nil
 }
 
 func (r *CacheRepo) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	err := r.Client.Set(ctx, key, value, expiration).Err()
+	err := r.breaker.Do(func() error {
+		return r.Client.Set(ctx, r.key(key), value, expiration).Err()
+	})
 	if err != nil {
 		return fmt.Errorf("redis - Set - r.Client.Set: %w", err)
 	}
 	return nil
 }
+
+// SetMany writes all items in a single pipeline round trip.
+func (r *CacheRepo) SetMany(ctx context.Context, items []entity.CacheItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	err := r.breaker.Do(func() error {
+		_, err := r.Client.Pipelined(ctx, func(pipe redisv8.Pipeliner) error {
+			for _, item := range items {
+				pipe.Set(ctx, r.key(item.Key), item.Value, item.Expiration)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("redis - SetMany - r.Client.Pipelined: %w", err)
+	}
+	return nil
+}
+
+// Keys lists the keys matching a glob pattern. It scans the keyspace incrementally,
+// so it does not block Redis, but keys written during the scan may be missed.
+func (r *CacheRepo) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	err := r.breaker.Do(func() error {
+		iter := r.Client.Scan(ctx, 0, r.key(pattern), _scanCount).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, strings.TrimPrefix(iter.Val(), r.prefix))
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis - Keys - r.Client.Scan: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *CacheRepo) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, r.key(key))
+	}
+
+	err := r.breaker.Do(func() error {
+		return r.Client.Del(ctx, prefixed...).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("redis - Delete - r.Client.Del: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/realPointer/banners/pkg/circuitbreaker"
+	"github.com/realPointer/banners/pkg/redis"
+)
+
+const _invalidationChannel = "banners:cache:invalidate"
+
+// InvalidationRepo broadcasts evicted cache keys to every instance over Redis pub/sub. The channel
+// name is prefixed with prefix like the keys of CacheRepo. Delivery is at most once: instances that
+// are disconnected when a message is published miss it.
+type InvalidationRepo struct {
+	*redis.Redis
+	breaker *circuitbreaker.Breaker
+	channel string
+}
+
+func NewInvalidationRepo(rdb *redis.Redis, breaker *circuitbreaker.Breaker, prefix string) *InvalidationRepo {
+	return &InvalidationRepo{
+		Redis:   rdb,
+		breaker: breaker,
+		channel: prefix + _invalidationChannel,
+	}
+}
+
+func (r *InvalidationRepo) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("redis - Publish - json.Marshal: %w", err)
+	}
+
+	err = r.breaker.Do(func() error {
+		return r.Client.Publish(ctx, r.channel, payload).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("redis - Publish - r.Client.Publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe calls onKeys with the keys of every message published until ctx is done.
+// The subscription reconnects on its own while Redis is unavailable.
+func (r *InvalidationRepo) Subscribe(ctx context.Context, onKeys func(keys []string)) error {
+	pubsub := r.Client.Subscribe(ctx, r.channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("redis - Subscribe - pubsub.Channel: closed")
+			}
+
+			// Messages not published by Publish are skipped.
+			var keys []string
+			if err := json.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+				continue
+			}
+			onKeys(keys)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/realPointer/banners/pkg/circuitbreaker"
+	"github.com/realPointer/banners/pkg/redis"
+)
+
+const _revokedTokenPrefix = "auth:revoked:"
+
+// RevocationRepo keeps the IDs (jti) of revoked access tokens until the tokens expire on their own.
+type RevocationRepo struct {
+	*redis.Redis
+	breaker *circuitbreaker.Breaker
+	prefix  string
+}
+
+func NewRevocationRepo(rdb *redis.Redis, breaker *circuitbreaker.Breaker, prefix string) *RevocationRepo {
+	return &RevocationRepo{
+		Redis:   rdb,
+		breaker: breaker,
+		prefix:  prefix + _revokedTokenPrefix,
+	}
+}
+
+func (r *RevocationRepo) Revoke(ctx context.Context, tokenID string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	err := r.breaker.Do(func() error {
+		return r.Client.Set(ctx, r.prefix+tokenID, 1, ttl).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("redis - Revoke - r.Client.Set: %w", err)
+	}
+	return nil
+}
+
+func (r *RevocationRepo) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var n int64
+	err := r.breaker.Do(func() error {
+		var err error
+		n, err = r.Client.Exists(ctx, r.prefix+tokenID).Result()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("redis - IsRevoked - r.Client.Exists: %w", err)
+	}
+	return n > 0, nil
+}
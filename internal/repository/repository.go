@@ -7,33 +7,104 @@ import (
 	"time"
 
 	"github.com/realPointer/banners/internal/entity"
+	memoryrepo "github.com/realPointer/banners/internal/repository/memory"
 	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
 	redisrepo "github.com/realPointer/banners/internal/repository/redis"
+	"github.com/realPointer/banners/pkg/circuitbreaker"
 	"github.com/realPointer/banners/pkg/postgres"
 	"github.com/realPointer/banners/pkg/redis"
 	"github.com/rs/zerolog"
 )
 
 type Banner interface {
-	GetBanner(ctx context.Context, tagID, featureID int) (string, error)
-	GetBanners(ctx context.Context, featureID, tagID, limit, offset *int) ([]entity.BannerInfo, error)
-	CreateBanner(ctx context.Context, tagIDs []int, featureID int, content json.RawMessage, isActive bool) (int, error)
-	UpdateBanner(ctx context.Context, bannerID int, tagIDs []int, featureID *int, content json.RawMessage, isActive *bool) error
-	DeleteBanner(ctx context.Context, bannerID int) error
-	DeleteBannersByFeatureID(ctx context.Context, featureID int) error
-	DeleteBannersByTagID(ctx context.Context, tagID int) error
+	GetBanner(ctx context.Context, tagID, featureID int, version *int) (*entity.UserBanner, error)
+	GetNextActivation(ctx context.Context, tagID, featureID int) (*time.Time, error)
+	GetBanners(ctx context.Context, featureID, tagID, limit, offset *int, deleted bool) ([]entity.BannerInfo, error)
+	CreateBanner(
+		ctx context.Context, tagIDs []int, featureID int, content json.RawMessage, variants []entity.BannerVariant, isActive bool,
+		activeFrom, activeUntil *time.Time,
+	) (int, error)
+	UpdateBanner(
+		ctx context.Context, bannerID int, tagIDs []int, featureID *int, content json.RawMessage, variants []entity.BannerVariant,
+		isActive *bool, activeFrom, activeUntil entity.NullableTime,
+	) error
+	DeleteBanner(ctx context.Context, bannerID int, deletedBy string, hard bool) error
+	CountBanners(ctx context.Context, featureID, tagID *int) (int, error)
+	SoftDeleteBannersBatch(ctx context.Context, featureID, tagID *int, deletedBy string, batchSize int) ([]int, error)
+	RestoreBanner(ctx context.Context, bannerID int) error
+	PurgeDeletedBanners(ctx context.Context, retention time.Duration, batchSize int) (int, error)
+	GetBannerVersions(ctx context.Context, bannerID int) ([]entity.BannerVersion, error)
+	GetBannerVersion(ctx context.Context, bannerID, version int) (*entity.BannerVersion, error)
+	RollbackBanner(ctx context.Context, bannerID, version int) error
+	SetPinnedVersion(ctx context.Context, bannerID int, version *int) error
+	GetFeatureTags(ctx context.Context, bannerIDs []int) ([]entity.FeatureTag, error)
+	GetActiveBanners(ctx context.Context, after *entity.FeatureTag, limit int) ([]entity.ActiveBanner, error)
 }
 
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetMany(ctx context.Context, items []entity.CacheItem) error
+	Keys(ctx context.Context, pattern string) ([]string, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// LocalCache is the in-process cache tier of a single instance.
+type LocalCache interface {
+	Evict(keys ...string)
+}
+
+type Invalidation interface {
+	Publish(ctx context.Context, keys ...string) error
+	Subscribe(ctx context.Context, onKeys func(keys []string)) error
+}
+
+type CachePolicy interface {
+	GetFeatureTTLs(ctx context.Context) ([]entity.FeatureCacheTTL, error)
+	SetFeatureTTL(ctx context.Context, featureID int, ttl time.Duration) error
+	DeleteFeatureTTL(ctx context.Context, featureID int) error
+}
+
+type Job interface {
+	CreateJob(ctx context.Context, kind string, targetID int, createdBy string) (int, error)
+	GetJob(ctx context.Context, jobID int) (*entity.Job, error)
+	AcquireJob(ctx context.Context, staleAfter time.Duration) (*entity.Job, error)
+	UpdateJobProgress(ctx context.Context, jobID, total, processed int) error
+	FinishJob(ctx context.Context, jobID int, jobErr error) error
 }
 
 type User interface {
 	CreateUser(ctx context.Context, user *entity.User) error
+	CreateFirstAdmin(ctx context.Context, user *entity.User) error
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 }
 
+type RefreshToken interface {
+	CreateRefreshToken(ctx context.Context, tokenHash string, token *entity.RefreshToken, ttl time.Duration) error
+	UseRefreshToken(ctx context.Context, tokenHash string) (*entity.RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, tokenHash, username string) error
+	DeleteExpiredRefreshTokens(ctx context.Context) error
+}
+
+type SigningKey interface {
+	CreateSigningKey(ctx context.Context, key *entity.SigningKey) error
+	GetSigningKeys(ctx context.Context, now time.Time) ([]entity.SigningKey, error)
+	DeleteExpiredSigningKeys(ctx context.Context, now time.Time) error
+}
+
+type APIKey interface {
+	CreateAPIKey(ctx context.Context, key *entity.APIKey, keyHash string) (int, error)
+	GetAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*entity.APIKey, error)
+	TouchAPIKey(ctx context.Context, id int, usedAt time.Time, every time.Duration) error
+	RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time) error
+}
+
+type Revocation interface {
+	Revoke(ctx context.Context, tokenID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
 var (
 	ErrBannerNotFound = errors.New("banner not found")
 )
@@ -41,13 +112,63 @@ var (
 type Repositories struct {
 	Banner
 	Cache
+	// LocalCache is nil when the local cache tier is disabled.
+	LocalCache
+	Invalidation
+	CachePolicy
+	Job
 	User
+	RefreshToken
+	Revocation
+	SigningKey
+	APIKey
+}
+
+type CacheConfig struct {
+	KeyPrefix       string
+	LocalSize       int
+	LocalTTL        time.Duration
+	BreakerFailures int
+	BreakerCooldown time.Duration
 }
 
-func NewRepositories(l *zerolog.Logger, pg *postgres.Postgres, rdb *redis.Redis) *Repositories {
-	return &Repositories{
-		Banner: postgresrepo.NewBannerRepo(pg, l),
-		Cache:  redisrepo.NewCacheRepo(rdb),
-		User:   postgresrepo.NewUserRepo(pg, l),
+func NewRepositories(l *zerolog.Logger, pg *postgres.Postgres, rdb *redis.Redis, cacheCfg CacheConfig) *Repositories {
+	breaker := circuitbreaker.New(
+		circuitbreaker.MaxFailures(cacheCfg.BreakerFailures),
+		circuitbreaker.Cooldown(cacheCfg.BreakerCooldown),
+		circuitbreaker.OnStateChange(func(from, to circuitbreaker.State) {
+			l.Warn().Str("from", from.String()).Str("to", to.String()).Msg("repository - redis cache circuit breaker")
+		}),
+	)
+
+	// Revocation checks get a breaker of their own, so cache errors do not make them fail faster
+	// and a revocation outage is reported on its own.
+	revocationBreaker := circuitbreaker.New(
+		circuitbreaker.MaxFailures(cacheCfg.BreakerFailures),
+		circuitbreaker.Cooldown(cacheCfg.BreakerCooldown),
+		circuitbreaker.OnStateChange(func(from, to circuitbreaker.State) {
+			l.Warn().Str("from", from.String()).Str("to", to.String()).Msg("repository - redis revocation circuit breaker")
+		}),
+	)
+
+	repositories := &Repositories{
+		Banner:       postgresrepo.NewBannerRepo(pg, l),
+		Cache:        redisrepo.NewCacheRepo(rdb, breaker, cacheCfg.KeyPrefix),
+		Invalidation: redisrepo.NewInvalidationRepo(rdb, breaker, cacheCfg.KeyPrefix),
+		CachePolicy:  postgresrepo.NewCachePolicyRepo(pg, l),
+		Job:          postgresrepo.NewJobRepo(pg, l),
+		User:         postgresrepo.NewUserRepo(pg, l),
+		RefreshToken: postgresrepo.NewRefreshTokenRepo(pg, l),
+		Revocation:   redisrepo.NewRevocationRepo(rdb, revocationBreaker, cacheCfg.KeyPrefix),
+		SigningKey:   postgresrepo.NewSigningKeyRepo(pg, l),
+		APIKey:       postgresrepo.NewAPIKeyRepo(pg, l),
 	}
+
+	if cacheCfg.LocalSize > 0 {
+		localCache := memoryrepo.NewCacheRepo(repositories.Cache, cacheCfg.LocalSize, cacheCfg.LocalTTL)
+		repositories.Cache = localCache
+		repositories.LocalCache = localCache
+	}
+
+	return repositories
 }
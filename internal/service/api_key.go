@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/pkg/logger"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// _apiKeyPrefix makes API keys recognizable, for example by secret scanners.
+	_apiKeyPrefix = "bnr_"
+	// _apiKeyTouchInterval is how often the last-used time of a busy key is written.
+	_apiKeyTouchInterval = time.Minute
+	// _apiKeyCacheTTL is how long a key looked up by its hash is reused without reading it again.
+	// A key revoked on another instance keeps working there for up to this long.
+	_apiKeyCacheTTL = 10 * time.Second
+	// _apiKeyIdentityPrefix starts the username of requests made with an API key. Account names may
+	// not start with it, so a key never acts as a user of the same name.
+	_apiKeyIdentityPrefix = "api-key:"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrInvalidName   = errors.New("invalid name")
+	ErrInvalidExpiry = errors.New("expires_at must be in the future")
+)
+
+type APIKeyService struct {
+	apiKeyRepo repository.APIKey
+	l          *zerolog.Logger
+
+	// mu guards cached, the keys recently looked up by their hash.
+	mu     sync.Mutex
+	cached map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	apiKey   entity.APIKey
+	cachedAt time.Time
+}
+
+func NewAPIKeyService(l *zerolog.Logger, apiKeyRepo repository.APIKey) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+		l:          l,
+		cached:     make(map[string]cachedAPIKey),
+	}
+}
+
+// CreateAPIKey issues a key for a service. The returned key is not stored and cannot be shown again.
+func (s *APIKeyService) CreateAPIKey(
+	ctx context.Context, name, role string, expiresAt *time.Time, createdBy string,
+) (*entity.CreatedAPIKey, error) {
+	ctx, span := _tracer.Start(ctx, "APIKeyService.CreateAPIKey")
+	defer span.End()
+
+	if strings.TrimSpace(name) == "" {
+		return nil, ErrInvalidName
+	}
+	if role != entity.RoleUser && role != entity.RoleAdmin {
+		return nil, ErrInvalidRole
+	}
+
+	now := time.Now().UTC()
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, ErrInvalidExpiry
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	key := _apiKeyPrefix + secret
+
+	apiKey := entity.APIKey{
+		Name:      name,
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	apiKey.ID, err = s.apiKeyRepo.CreateAPIKey(ctx, &apiKey, hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.CreatedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func (s *APIKeyService) GetAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	ctx, span := _tracer.Start(ctx, "APIKeyService.GetAPIKeys")
+	defer span.End()
+
+	return s.apiKeyRepo.GetAPIKeys(ctx)
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, span := _tracer.Start(ctx, "APIKeyService.RevokeAPIKey")
+	defer span.End()
+
+	if err := s.apiKeyRepo.RevokeAPIKey(ctx, id, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for keyHash, cached := range s.cached {
+		if cached.apiKey.ID == id {
+			delete(s.cached, keyHash)
+		}
+	}
+
+	return nil
+}
+
+// Authenticate returns the claims of a live API key, identified as api-key:<id>, and records its use.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*TokenClaims, error) {
+	ctx, span := _tracer.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+
+	if !strings.HasPrefix(key, _apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now().UTC()
+	keyHash := hashToken(key)
+
+	apiKey, err := s.lookup(ctx, keyHash, now)
+	if err != nil {
+		if errors.Is(err, postgresrepo.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && !apiKey.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// The last-used time is only written once per _apiKeyTouchInterval. Failing to record the use
+	// must not fail the request it authenticates.
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= _apiKeyTouchInterval {
+		if err := s.apiKeyRepo.TouchAPIKey(ctx, apiKey.ID, now, _apiKeyTouchInterval); err != nil {
+			logger.FromContext(ctx, s.l).Warn().Err(err).Int("api_key_id", apiKey.ID).
+				Msg("APIKeyService.Authenticate - s.apiKeyRepo.TouchAPIKey")
+		} else {
+			s.touched(keyHash, now)
+		}
+	}
+
+	identity := _apiKeyIdentityPrefix + strconv.Itoa(apiKey.ID)
+	claims := &TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: identity,
+		},
+		Username: identity,
+		Role:     apiKey.Role,
+	}
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+
+	return claims, nil
+}
+
+// lookup returns the key with the given hash, read from the database at most once per _apiKeyCacheTTL.
+func (s *APIKeyService) lookup(ctx context.Context, keyHash string, now time.Time) (*entity.APIKey, error) {
+	s.mu.Lock()
+	cached, ok := s.cached[keyHash]
+	s.mu.Unlock()
+
+	if ok && now.Sub(cached.cachedAt) < _apiKeyCacheTTL {
+		return &cached.apiKey, nil
+	}
+
+	apiKey, err := s.apiKeyRepo.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only keys that exist are cached, so the entries are bounded by the number of keys. Expired
+	// entries are dropped here rather than by a background sweep.
+	for hash, cached := range s.cached {
+		if now.Sub(cached.cachedAt) >= _apiKeyCacheTTL {
+			delete(s.cached, hash)
+		}
+	}
+	s.cached[keyHash] = cachedAPIKey{apiKey: *apiKey, cachedAt: now}
+
+	return apiKey, nil
+}
+
+// touched records in the cached copy of a key that it was used at usedAt.
+func (s *APIKeyService) touched(keyHash string, usedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.cached[keyHash]; ok {
+		cached.apiKey.LastUsedAt = &usedAt
+		s.cached[keyHash] = cached
+	}
+}
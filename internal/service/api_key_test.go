@@ -0,0 +1,198 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type fakeAPIKeyRepo struct {
+	keys    map[string]*entity.APIKey
+	lookups int
+	touches int
+}
+
+func newFakeAPIKeyRepo() *fakeAPIKeyRepo {
+	return &fakeAPIKeyRepo{keys: make(map[string]*entity.APIKey)}
+}
+
+func (r *fakeAPIKeyRepo) CreateAPIKey(_ context.Context, key *entity.APIKey, keyHash string) (int, error) {
+	stored := *key
+	stored.ID = len(r.keys) + 1
+	r.keys[keyHash] = &stored
+	return stored.ID, nil
+}
+
+func (r *fakeAPIKeyRepo) GetAPIKeys(context.Context) ([]entity.APIKey, error) {
+	keys := make([]entity.APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepo) GetAPIKeyByHash(_ context.Context, keyHash string) (*entity.APIKey, error) {
+	r.lookups++
+	key, ok := r.keys[keyHash]
+	if !ok {
+		return nil, postgresrepo.ErrAPIKeyNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+func (r *fakeAPIKeyRepo) TouchAPIKey(_ context.Context, id int, usedAt time.Time, _ time.Duration) error {
+	for _, key := range r.keys {
+		if key.ID == id {
+			key.LastUsedAt = &usedAt
+			r.touches++
+		}
+	}
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) RevokeAPIKey(_ context.Context, id int, revokedAt time.Time) error {
+	for _, key := range r.keys {
+		if key.ID == id && key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+			return nil
+		}
+	}
+	return postgresrepo.ErrAPIKeyNotFound
+}
+
+func newAPIKeyService(repo *fakeAPIKeyRepo) *service.APIKeyService {
+	l := zerolog.Nop()
+	return service.NewAPIKeyService(&l, repo)
+}
+
+func TestAPIKeyAuthenticates(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeAPIKeyRepo()
+	s := newAPIKeyService(repo)
+
+	created, err := s.CreateAPIKey(ctx, "recommendations", entity.RoleUser, nil, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, "bnr_") {
+		t.Errorf("key = %q, want bnr_ prefix", created.Key)
+	}
+	if _, ok := repo.keys[created.Key]; ok {
+		t.Error("API key stored in plain text")
+	}
+
+	claims, err := s.Authenticate(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	wantUsername := fmt.Sprintf("api-key:%d", created.ID)
+	if claims.Username != wantUsername || claims.Role != entity.RoleUser {
+		t.Errorf("claims = %s/%s, want %s/%s", claims.Username, claims.Role, wantUsername, entity.RoleUser)
+	}
+	if repo.touches != 1 {
+		t.Errorf("last-used updates = %d, want 1", repo.touches)
+	}
+}
+
+func TestAPIKeyAuthenticatesRepeatedUseFromCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeAPIKeyRepo()
+	s := newAPIKeyService(repo)
+
+	created, err := s.CreateAPIKey(ctx, "recommendations", entity.RoleUser, nil, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Authenticate(ctx, created.Key); err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+	}
+
+	if repo.lookups != 1 {
+		t.Errorf("lookups by hash = %d, want 1", repo.lookups)
+	}
+	if repo.touches != 1 {
+		t.Errorf("last-used updates = %d, want 1", repo.touches)
+	}
+
+	if err := s.RevokeAPIKey(ctx, created.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, created.Key); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("Authenticate of a cached key after revocation error = %v, want %v", err, service.ErrInvalidAPIKey)
+	}
+}
+
+func TestAPIKeyRejectsRevokedAndExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeAPIKeyRepo()
+	s := newAPIKeyService(repo)
+
+	revoked, err := s.CreateAPIKey(ctx, "revoked", entity.RoleUser, nil, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := s.RevokeAPIKey(ctx, revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, revoked.Key); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("Authenticate of revoked key error = %v, want %v", err, service.ErrInvalidAPIKey)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	expiring, err := s.CreateAPIKey(ctx, "expiring", entity.RoleUser, &expiresAt, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	for _, key := range repo.keys {
+		if key.ID == expiring.ID {
+			past := time.Now().Add(-time.Minute)
+			key.ExpiresAt = &past
+		}
+	}
+	if _, err := s.Authenticate(ctx, expiring.Key); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("Authenticate of expired key error = %v, want %v", err, service.ErrInvalidAPIKey)
+	}
+
+	if _, err := s.Authenticate(ctx, "bnr_unknown"); !errors.Is(err, service.ErrInvalidAPIKey) {
+		t.Errorf("Authenticate of unknown key error = %v, want %v", err, service.ErrInvalidAPIKey)
+	}
+}
+
+func TestCreateAPIKeyValidates(t *testing.T) {
+	ctx := context.Background()
+	s := newAPIKeyService(newFakeAPIKeyRepo())
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		keyName   string
+		role      string
+		expiresAt *time.Time
+		want      error
+	}{
+		{name: "empty name", keyName: " ", role: entity.RoleUser, want: service.ErrInvalidName},
+		{name: "unknown role", keyName: "svc", role: "root", want: service.ErrInvalidRole},
+		{name: "past expiry", keyName: "svc", role: entity.RoleUser, expiresAt: &past, want: service.ErrInvalidExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateAPIKey(ctx, tt.keyName, tt.role, tt.expiresAt, "admin")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CreateAPIKey error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,21 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/realPointer/banners/internal/entity"
 	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/pkg/logger"
 	"github.com/rs/zerolog"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -18,26 +27,140 @@ type TokenClaims struct {
 	Role     string
 }
 
+var (
+	ErrRegistrationClosed    = errors.New("registration is closed")
+	ErrInvalidRole           = errors.New("invalid role")
+	ErrBootstrapDisabled     = errors.New("admin bootstrap is disabled")
+	ErrInvalidBootstrapToken = errors.New("invalid bootstrap token")
+	ErrInvalidToken          = errors.New("invalid token")
+	ErrTokenRevoked          = errors.New("token revoked")
+	ErrNoSigningKey          = errors.New("no signing key")
+	ErrRevocationUnavailable = errors.New("token revocation list unavailable")
+)
+
+// _tokenParser only accepts the asymmetric algorithms keys are generated for. The algorithm of each
+// token is also checked against the key it names.
+var _tokenParser = &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}}
+
+// TokenConfig configures the issued tokens.
+type TokenConfig struct {
+	// SignKey encrypts the signing keys stored in the database.
+	SignKey string
+	// Algorithm is the algorithm new signing keys are generated for, RS256 or EdDSA.
+	Algorithm string
+	// KeyRotation is how long a signing key is used before a new one replaces it. Replaced keys
+	// keep verifying until the tokens they signed expire.
+	KeyRotation time.Duration
+	// AccessTTL is the lifetime of access tokens. Keep it short: a revoked token is only
+	// rejected while Redis is reachable.
+	AccessTTL time.Duration
+	// RefreshTTL is the lifetime of refresh tokens. Every refresh issues a new one.
+	RefreshTTL time.Duration
+	// RevocationFailOpen accepts tokens with the user role while the revocation list cannot be read,
+	// so a Redis outage does not lock every user out. Admin tokens are never accepted then.
+	RevocationFailOpen bool
+}
+
+// RegistrationConfig controls who may create accounts.
+type RegistrationConfig struct {
+	// Open allows anonymous callers to register accounts with the user role.
+	Open bool
+	// BootstrapToken lets the first admin account be created without an admin token.
+	// Bootstrapping is disabled when it is empty.
+	BootstrapToken string
+}
+
 type AuthService struct {
-	userRepo repository.User
-	signKey  string
-	tokenTTL time.Duration
-	salt     string
-	l        *zerolog.Logger
+	userRepo         repository.User
+	refreshTokenRepo repository.RefreshToken
+	revocationRepo   repository.Revocation
+	signingKeyRepo   repository.SigningKey
+	keys             keyRing
+	verifiers        []TokenVerifier
+	tokens           TokenConfig
+	salt             string
+	registration     RegistrationConfig
+	l                *zerolog.Logger
 }
 
-func NewAuthService(l *zerolog.Logger, userRepo repository.User, signKey string, tokenTTL time.Duration, salt string) *AuthService {
+func NewAuthService(
+	l *zerolog.Logger, userRepo repository.User, refreshTokenRepo repository.RefreshToken,
+	revocationRepo repository.Revocation, signingKeyRepo repository.SigningKey, tokens TokenConfig, salt string,
+	registration RegistrationConfig, verifiers ...TokenVerifier,
+) *AuthService {
 	return &AuthService{
-		l:        l,
-		userRepo: userRepo,
-		signKey:  signKey,
-		tokenTTL: tokenTTL,
-		salt:     salt,
+		l:                l,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocationRepo:   revocationRepo,
+		signingKeyRepo:   signingKeyRepo,
+		tokens:           tokens,
+		salt:             salt,
+		registration:     registration,
+		verifiers:        verifiers,
+	}
+}
+
+// Register creates an account with the user role for an anonymous caller.
+func (s *AuthService) Register(ctx context.Context, username, password string) error {
+	ctx, span := _tracer.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	if !s.registration.Open {
+		return ErrRegistrationClosed
+	}
+
+	return s.createUser(ctx, username, password, entity.RoleUser)
+}
+
+// CreateUser creates an account with any role. Callers must make sure it is requested by an admin.
+func (s *AuthService) CreateUser(ctx context.Context, username, password, role string) error {
+	ctx, span := _tracer.Start(ctx, "AuthService.CreateUser")
+	defer span.End()
+
+	if role != entity.RoleUser && role != entity.RoleAdmin {
+		return ErrInvalidRole
 	}
+
+	return s.createUser(ctx, username, password, role)
+}
+
+// Bootstrap creates the first admin account when token matches the configured bootstrap token.
+// It fails with postgresrepo.ErrAdminExists once any admin exists.
+func (s *AuthService) Bootstrap(ctx context.Context, token, username, password string) error {
+	ctx, span := _tracer.Start(ctx, "AuthService.Bootstrap")
+	defer span.End()
+
+	if s.registration.BootstrapToken == "" {
+		return ErrBootstrapDisabled
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.registration.BootstrapToken)) != 1 {
+		return ErrInvalidBootstrapToken
+	}
+
+	if strings.HasPrefix(username, _apiKeyIdentityPrefix) {
+		return ErrInvalidName
+	}
+
+	hashedPassword, err := s.hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.CreateFirstAdmin(ctx, &entity.User{
+		Username: username,
+		Password: hashedPassword,
+		Role:     entity.RoleAdmin,
+	})
 }
 
-func (s *AuthService) Register(ctx context.Context, username, password, role string) error {
-	hashedPassword, err := s.hashPassword(password)
+func (s *AuthService) createUser(ctx context.Context, username, password, role string) error {
+	if strings.HasPrefix(username, _apiKeyIdentityPrefix) {
+		return ErrInvalidName
+	}
+
+	hashedPassword, err := s.hashPassword(ctx, password)
 	if err != nil {
 		return err
 	}
@@ -55,35 +178,144 @@ func (s *AuthService) Register(ctx context.Context, username, password, role str
 	return nil
 }
 
-func (s *AuthService) Login(ctx context.Context, username, password string) (string, error) {
+func (s *AuthService) Login(ctx context.Context, username, password string) (*entity.TokenPair, error) {
+	ctx, span := _tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
 	user, err := s.userRepo.GetUserByUsername(ctx, username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	_, hashSpan := _tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password+s.salt))
+	hashSpan.End()
+	if err != nil {
+		return nil, errors.New("invalid password")
+	}
+
+	familyID, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, familyID)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token is rotated: it stops
+// working once used. Presenting it again revokes every token issued from the same login, since
+// either the client or an attacker holds a stolen copy.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*entity.TokenPair, error) {
+	ctx, span := _tracer.Start(ctx, "AuthService.Refresh")
+	defer span.End()
+
+	tokenHash := hashToken(refreshToken)
+
+	token, err := s.refreshTokenRepo.UseRefreshToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, postgresrepo.ErrRefreshTokenReused) {
+			logger.FromContext(ctx, s.l).Warn().Msg("AuthService.Refresh - refresh token reused, revoking its family")
+			if err := s.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, tokenHash, ""); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByUsername(ctx, token.Username)
 	if err != nil {
-		return "", errors.New("invalid password")
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, token.FamilyID)
+}
+
+// Logout revokes the access token described by claims and, when given, the refresh token
+// issued with it. A refresh token issued to someone else is left alone.
+func (s *AuthService) Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error {
+	ctx, span := _tracer.Start(ctx, "AuthService.Logout")
+	defer span.End()
+
+	if refreshToken != "" {
+		if err := s.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, hashToken(refreshToken), claims.Username); err != nil {
+			return err
+		}
+	}
+
+	if claims.Id == "" {
+		return nil
+	}
+
+	return s.revocationRepo.Revoke(ctx, claims.Id, time.Until(time.Unix(claims.ExpiresAt, 0)))
+}
+
+// issueTokens signs an access token for user and stores a new refresh token in familyID.
+func (s *AuthService) issueTokens(ctx context.Context, user *entity.User, familyID string) (*entity.TokenPair, error) {
+	tokenID, err := randomToken()
+	if err != nil {
+		return nil, err
 	}
 
 	claims := &TokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(s.tokenTTL).Unix(),
+			Id:        tokenID,
+			ExpiresAt: time.Now().Add(s.tokens.AccessTTL).Unix(),
 		},
 		Username: user.Username,
 		Role:     user.Role,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.signKey))
+	key, ok := s.keys.signing(time.Now())
+	if !ok {
+		return nil, ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	accessToken, err := token.SignedString(key.private)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refreshTokenRepo.CreateRefreshToken(ctx, hashToken(refreshToken), &entity.RefreshToken{
+		FamilyID: familyID,
+		Username: user.Username,
+	}, s.tokens.RefreshTTL)
+	if err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &entity.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.tokens.AccessTTL.Seconds()),
+	}, nil
 }
 
-func (s *AuthService) hashPassword(password string) (string, error) {
+// randomToken returns 32 random bytes encoded for use in URLs and headers.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("randomToken - rand.Read: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored, so a database leak does not leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuthService) hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := _tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password+s.salt), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
@@ -91,19 +323,148 @@ func (s *AuthService) hashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func (s *AuthService) ParseToken(tokenString string) (*TokenClaims, error) {
+// ParseToken verifies an access token issued by Login or, failing that, by one of the external
+// verifiers, and rejects revoked ones. When the revocation list cannot be read, the token is rejected
+// with ErrRevocationUnavailable, unless it has the user role and TokenConfig.RevocationFailOpen is set.
+func (s *AuthService) ParseToken(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	claims, err := s.parseLocalToken(tokenString)
+	for _, verifier := range s.verifiers {
+		if err == nil {
+			break
+		}
+		claims, err = verifier.Verify(ctx, tokenString)
+		if err != nil {
+			logger.FromContext(ctx, s.l).Debug().Err(err).Msg("AuthService.ParseToken - verifier.Verify")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// External tokens without an ID cannot be revoked, only expire.
+	if claims.Id == "" {
+		return claims, nil
+	}
+
+	revoked, err := s.revocationRepo.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		logCacheError(logger.FromContext(ctx, s.l), err, "AuthService.ParseToken - s.revocationRepo.IsRevoked")
+		if !s.tokens.RevocationFailOpen || claims.Role != entity.RoleUser {
+			return nil, fmt.Errorf("AuthService.ParseToken - %w: %w", ErrRevocationUnavailable, err)
+		}
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// parseLocalToken verifies a token signed by issueTokens.
+func (s *AuthService) parseLocalToken(tokenString string) (*TokenClaims, error) {
 	claims := &TokenClaims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.signKey), nil
+	token, err := _tokenParser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := s.keys.lookup(kid, time.Now())
+		if !ok || token.Method.Alg() != key.method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		return key.private.Public(), nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if !token.Valid {
-		return nil, errors.New("invalid token")
+	// Tokens issued before revocation was introduced carry no ID and could never be revoked.
+	if !token.Valid || claims.Id == "" {
+		return nil, ErrInvalidToken
 	}
 
 	return claims, nil
 }
+
+// JWKS returns the public keys tokens are currently verified with.
+func (s *AuthService) JWKS() entity.JWKS {
+	return s.keys.jwks(time.Now())
+}
+
+// RotateKeys creates a signing key when the newest usable one is due for rotation, drops expired keys
+// and reloads the key ring. Instances rotating at the same time may both create a key, which is harmless:
+// every stored key verifies, and signing settles on the newest.
+func (s *AuthService) RotateKeys(ctx context.Context) error {
+	ctx, span := _tracer.Start(ctx, "AuthService.RotateKeys")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	stored, err := s.signingKeyRepo.GetSigningKeys(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	// A key that cannot be opened, for example one sealed under a previous JWT_SIGN_KEY, is skipped
+	// and does not count as the newest key, so a usable one replaces it.
+	keys := make([]*signingKey, 0, len(stored)+1)
+	for i := range stored {
+		key, err := openSigningKey(&stored[i], s.tokens.SignKey)
+		if err != nil {
+			logger.FromContext(ctx, s.l).Err(err).Str("kid", stored[i].ID).Msg("AuthService.RotateKeys - openSigningKey")
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 || now.Sub(keys[0].createdAt) >= s.tokens.KeyRotation {
+		// A key signs for KeyRotation plus the time its successor needs to be created and become known,
+		// then verifies the tokens it signed until they expire.
+		lifetime := s.tokens.KeyRotation + _keyReloadInterval + _keySigningDelay + s.tokens.AccessTTL
+
+		created, err := generateSigningKey(s.tokens.Algorithm, s.tokens.SignKey, now, lifetime)
+		if err != nil {
+			return err
+		}
+
+		key, err := openSigningKey(created, s.tokens.SignKey)
+		if err != nil {
+			return err
+		}
+
+		if err := s.signingKeyRepo.CreateSigningKey(ctx, created); err != nil {
+			return err
+		}
+		logger.FromContext(ctx, s.l).Info().Str("kid", created.ID).Str("alg", created.Algorithm).
+			Msg("AuthService.RotateKeys - signing key created")
+
+		keys = append([]*signingKey{key}, keys...)
+	}
+	s.keys.set(keys)
+
+	if err := s.signingKeyRepo.DeleteExpiredSigningKeys(ctx, now); err != nil {
+		logger.FromContext(ctx, s.l).Warn().Err(err).Msg("AuthService.RotateKeys - s.signingKeyRepo.DeleteExpiredSigningKeys")
+	}
+
+	return nil
+}
+
+// Run rotates and reloads the signing keys and deletes expired refresh tokens until ctx is canceled.
+func (s *AuthService) Run(ctx context.Context) {
+	ticker := time.NewTicker(_keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.RotateKeys(ctx); err != nil {
+				s.l.Err(err).Msg("AuthService.Run - s.RotateKeys")
+			}
+			if err := s.refreshTokenRepo.DeleteExpiredRefreshTokens(ctx); err != nil {
+				s.l.Err(err).Msg("AuthService.Run - s.refreshTokenRepo.DeleteExpiredRefreshTokens")
+			}
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type fakeUserRepo struct {
+	repository.User
+	users map[string]*entity.User
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: make(map[string]*entity.User)}
+}
+
+func (r *fakeUserRepo) CreateUser(_ context.Context, user *entity.User) error {
+	if _, ok := r.users[user.Username]; ok {
+		return postgresrepo.ErrUserExists
+	}
+	r.users[user.Username] = user
+	return nil
+}
+
+func (r *fakeUserRepo) CreateFirstAdmin(ctx context.Context, user *entity.User) error {
+	for _, u := range r.users {
+		if u.Role == entity.RoleAdmin {
+			return postgresrepo.ErrAdminExists
+		}
+	}
+	return r.CreateUser(ctx, user)
+}
+
+func (r *fakeUserRepo) GetUserByUsername(_ context.Context, username string) (*entity.User, error) {
+	user, ok := r.users[username]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+type fakeRefreshToken struct {
+	token   entity.RefreshToken
+	used    bool
+	revoked bool
+}
+
+type fakeRefreshTokenRepo struct {
+	tokens map[string]*fakeRefreshToken
+}
+
+func newFakeRefreshTokenRepo() *fakeRefreshTokenRepo {
+	return &fakeRefreshTokenRepo{tokens: make(map[string]*fakeRefreshToken)}
+}
+
+func (r *fakeRefreshTokenRepo) CreateRefreshToken(
+	_ context.Context, tokenHash string, token *entity.RefreshToken, _ time.Duration,
+) error {
+	r.tokens[tokenHash] = &fakeRefreshToken{token: *token}
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) UseRefreshToken(_ context.Context, tokenHash string) (*entity.RefreshToken, error) {
+	t, ok := r.tokens[tokenHash]
+	switch {
+	case !ok || t.revoked:
+		return nil, postgresrepo.ErrRefreshTokenNotFound
+	case t.used:
+		return nil, postgresrepo.ErrRefreshTokenReused
+	}
+	t.used = true
+	token := t.token
+	return &token, nil
+}
+
+func (r *fakeRefreshTokenRepo) RevokeRefreshTokenFamily(_ context.Context, tokenHash, username string) error {
+	t, ok := r.tokens[tokenHash]
+	if !ok || (username != "" && t.token.Username != username) {
+		return nil
+	}
+	for _, other := range r.tokens {
+		if other.token.FamilyID == t.token.FamilyID {
+			other.revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) DeleteExpiredRefreshTokens(context.Context) error {
+	return nil
+}
+
+type fakeRevocation struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (r *fakeRevocation) Revoke(_ context.Context, tokenID string, _ time.Duration) error {
+	if r.revoked == nil {
+		r.revoked = make(map[string]bool)
+	}
+	r.revoked[tokenID] = true
+	return nil
+}
+
+func (r *fakeRevocation) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	return r.revoked[tokenID], r.err
+}
+
+type fakeSigningKeyRepo struct {
+	keys []entity.SigningKey
+}
+
+func (r *fakeSigningKeyRepo) CreateSigningKey(_ context.Context, key *entity.SigningKey) error {
+	r.keys = append([]entity.SigningKey{*key}, r.keys...)
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) GetSigningKeys(_ context.Context, now time.Time) ([]entity.SigningKey, error) {
+	var keys []entity.SigningKey
+	for _, key := range r.keys {
+		if key.ExpiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeSigningKeyRepo) DeleteExpiredSigningKeys(context.Context, time.Time) error {
+	return nil
+}
+
+func newAuthService(repo *fakeUserRepo, registration service.RegistrationConfig) *service.AuthService {
+	return newAuthServiceWithTokens(repo, newFakeRefreshTokenRepo(), &fakeRevocation{}, registration)
+}
+
+func newAuthServiceWithTokens(
+	repo *fakeUserRepo, refreshTokens *fakeRefreshTokenRepo, revocation *fakeRevocation,
+	registration service.RegistrationConfig,
+) *service.AuthService {
+	tokens := service.TokenConfig{
+		SignKey:     "key",
+		Algorithm:   "EdDSA",
+		KeyRotation: time.Hour,
+		AccessTTL:   time.Minute,
+		RefreshTTL:  time.Hour,
+	}
+	return newAuthServiceWithConfig(repo, refreshTokens, revocation, &fakeSigningKeyRepo{}, tokens, registration)
+}
+
+func newAuthServiceWithConfig(
+	repo *fakeUserRepo, refreshTokens *fakeRefreshTokenRepo, revocation *fakeRevocation, signingKeys *fakeSigningKeyRepo,
+	tokens service.TokenConfig, registration service.RegistrationConfig, verifiers ...service.TokenVerifier,
+) *service.AuthService {
+	l := zerolog.Nop()
+	return service.NewAuthService(&l, repo, refreshTokens, revocation, signingKeys, tokens, "salt", registration, verifiers...)
+}
+
+// loggedIn returns an auth service with a registered user and the tokens it logged in with.
+func loggedIn(t *testing.T, revocation *fakeRevocation) (*service.AuthService, *entity.TokenPair) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := newAuthServiceWithTokens(newFakeUserRepo(), newFakeRefreshTokenRepo(), revocation,
+		service.RegistrationConfig{Open: true})
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if err := s.Register(ctx, "alice", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	tokens, err := s.Login(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return s, tokens
+}
+
+func TestRegisterCreatesUserRole(t *testing.T) {
+	repo := newFakeUserRepo()
+	s := newAuthService(repo, service.RegistrationConfig{Open: true})
+
+	if err := s.Register(context.Background(), "alice", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if got := repo.users["alice"].Role; got != entity.RoleUser {
+		t.Errorf("registered role = %q, want %q", got, entity.RoleUser)
+	}
+}
+
+func TestRegisterRejectsWhenClosed(t *testing.T) {
+	repo := newFakeUserRepo()
+	s := newAuthService(repo, service.RegistrationConfig{Open: false})
+
+	err := s.Register(context.Background(), "alice", "secret")
+	if !errors.Is(err, service.ErrRegistrationClosed) {
+		t.Fatalf("Register error = %v, want %v", err, service.ErrRegistrationClosed)
+	}
+	if len(repo.users) != 0 {
+		t.Errorf("users after rejected registration = %d, want 0", len(repo.users))
+	}
+}
+
+func TestRegisterRejectsAPIKeyIdentity(t *testing.T) {
+	repo := newFakeUserRepo()
+	s := newAuthService(repo, service.RegistrationConfig{Open: true})
+
+	err := s.Register(context.Background(), "api-key:1", "secret")
+	if !errors.Is(err, service.ErrInvalidName) {
+		t.Fatalf("Register error = %v, want %v", err, service.ErrInvalidName)
+	}
+	if len(repo.users) != 0 {
+		t.Errorf("users after rejected registration = %d, want 0", len(repo.users))
+	}
+}
+
+func TestCreateUserRejectsUnknownRole(t *testing.T) {
+	s := newAuthService(newFakeUserRepo(), service.RegistrationConfig{})
+
+	err := s.CreateUser(context.Background(), "alice", "secret", "root")
+	if !errors.Is(err, service.ErrInvalidRole) {
+		t.Fatalf("CreateUser error = %v, want %v", err, service.ErrInvalidRole)
+	}
+}
+
+func TestBootstrapCreatesOnlyFirstAdmin(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeUserRepo()
+	s := newAuthService(repo, service.RegistrationConfig{BootstrapToken: "bootstrap"})
+
+	if err := s.Bootstrap(ctx, "wrong", "root", "secret"); !errors.Is(err, service.ErrInvalidBootstrapToken) {
+		t.Fatalf("Bootstrap with wrong token error = %v, want %v", err, service.ErrInvalidBootstrapToken)
+	}
+
+	if err := s.Bootstrap(ctx, "bootstrap", "root", "secret"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	if got := repo.users["root"].Role; got != entity.RoleAdmin {
+		t.Errorf("bootstrapped role = %q, want %q", got, entity.RoleAdmin)
+	}
+
+	if err := s.Bootstrap(ctx, "bootstrap", "root2", "secret"); !errors.Is(err, postgresrepo.ErrAdminExists) {
+		t.Errorf("second Bootstrap error = %v, want %v", err, postgresrepo.ErrAdminExists)
+	}
+}
+
+func TestBootstrapDisabledWithoutToken(t *testing.T) {
+	s := newAuthService(newFakeUserRepo(), service.RegistrationConfig{})
+
+	err := s.Bootstrap(context.Background(), "", "root", "secret")
+	if !errors.Is(err, service.ErrBootstrapDisabled) {
+		t.Fatalf("Bootstrap error = %v, want %v", err, service.ErrBootstrapDisabled)
+	}
+}
+
+func TestRefreshRotatesRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	s, tokens := loggedIn(t, &fakeRevocation{})
+
+	refreshed, err := s.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("Refresh returned the same refresh token")
+	}
+
+	claims, err := s.ParseToken(ctx, refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Username != "alice" || claims.Role != entity.RoleUser {
+		t.Errorf("refreshed claims = %s/%s, want alice/%s", claims.Username, claims.Role, entity.RoleUser)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	s, tokens := loggedIn(t, &fakeRevocation{})
+
+	refreshed, err := s.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, postgresrepo.ErrRefreshTokenReused) {
+		t.Fatalf("reused Refresh error = %v, want %v", err, postgresrepo.ErrRefreshTokenReused)
+	}
+
+	if _, err := s.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, postgresrepo.ErrRefreshTokenNotFound) {
+		t.Errorf("Refresh after reuse error = %v, want %v", err, postgresrepo.ErrRefreshTokenNotFound)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	s, tokens := loggedIn(t, &fakeRevocation{})
+
+	claims, err := s.ParseToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+
+	if err := s.Logout(ctx, claims, tokens.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := s.ParseToken(ctx, tokens.AccessToken); !errors.Is(err, service.ErrTokenRevoked) {
+		t.Errorf("ParseToken after Logout error = %v, want %v", err, service.ErrTokenRevoked)
+	}
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, postgresrepo.ErrRefreshTokenNotFound) {
+		t.Errorf("Refresh after Logout error = %v, want %v", err, postgresrepo.ErrRefreshTokenNotFound)
+	}
+}
+
+func TestLogoutKeepsRefreshTokenOfOtherUser(t *testing.T) {
+	ctx := context.Background()
+	s, tokens := loggedIn(t, &fakeRevocation{})
+
+	if err := s.Register(ctx, "bob", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	bobTokens, err := s.Login(ctx, "bob", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	claims, err := s.ParseToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if err := s.Logout(ctx, claims, bobTokens.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := s.Refresh(ctx, bobTokens.RefreshToken); err != nil {
+		t.Errorf("Refresh of another user's token after Logout: %v", err)
+	}
+}
+
+func TestParseTokenWhenRevocationUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		failOpen bool
+		role     string
+		accepted bool
+	}{
+		{name: "user, fail open", failOpen: true, role: entity.RoleUser, accepted: true},
+		{name: "admin, fail open", failOpen: true, role: entity.RoleAdmin, accepted: false},
+		{name: "user, fail closed", failOpen: false, role: entity.RoleUser, accepted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			revocation := &fakeRevocation{}
+			tokens := service.TokenConfig{
+				SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute, RefreshTTL: time.Hour,
+				RevocationFailOpen: tt.failOpen,
+			}
+			s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), revocation, &fakeSigningKeyRepo{},
+				tokens, service.RegistrationConfig{})
+			if err := s.RotateKeys(ctx); err != nil {
+				t.Fatalf("RotateKeys: %v", err)
+			}
+			if err := s.CreateUser(ctx, "alice", "secret", tt.role); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			issued, err := s.Login(ctx, "alice", "secret")
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+
+			revocation.err = errors.New("redis down")
+			_, err = s.ParseToken(ctx, issued.AccessToken)
+			switch {
+			case tt.accepted && err != nil:
+				t.Errorf("ParseToken with revocation list unavailable: %v", err)
+			case !tt.accepted && !errors.Is(err, service.ErrRevocationUnavailable):
+				t.Errorf("ParseToken error = %v, want %v", err, service.ErrRevocationUnavailable)
+			}
+		})
+	}
+}
+
+func TestParseTokenRejectsOtherAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	s, tokens := loggedIn(t, &fakeRevocation{})
+
+	claims, err := s.ParseToken(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+
+	kid := s.JWKS().Keys[0].Kid
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodHS256, jwt.SigningMethodNone} {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+
+		var key interface{} = []byte("key")
+		if method == jwt.SigningMethodNone {
+			key = jwt.UnsafeAllowNoneSignatureType
+		}
+
+		forged, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString(%s): %v", method.Alg(), err)
+		}
+
+		if _, err := s.ParseToken(ctx, forged); err == nil {
+			t.Errorf("ParseToken accepted a token signed with %s", method.Alg())
+		}
+	}
+}
+
+func TestRotateKeysKeepsOldKeysVerifying(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			ctx := context.Background()
+			tokens := service.TokenConfig{SignKey: "key", Algorithm: algorithm, AccessTTL: time.Minute, RefreshTTL: time.Hour}
+			s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{},
+				&fakeSigningKeyRepo{}, tokens, service.RegistrationConfig{Open: true})
+
+			if err := s.RotateKeys(ctx); err != nil {
+				t.Fatalf("RotateKeys: %v", err)
+			}
+			if err := s.Register(ctx, "alice", "secret"); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			issued, err := s.Login(ctx, "alice", "secret")
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+
+			// A zero rotation period replaces the key on every call.
+			if err := s.RotateKeys(ctx); err != nil {
+				t.Fatalf("RotateKeys: %v", err)
+			}
+
+			jwks := s.JWKS()
+			if len(jwks.Keys) != 2 {
+				t.Fatalf("JWKS has %d keys, want 2", len(jwks.Keys))
+			}
+			for _, key := range jwks.Keys {
+				if key.Alg != algorithm || key.Kid == "" {
+					t.Errorf("JWKS key = %+v, want alg %s with a kid", key, algorithm)
+				}
+			}
+
+			if _, err := s.ParseToken(ctx, issued.AccessToken); err != nil {
+				t.Errorf("ParseToken after rotation: %v", err)
+			}
+		})
+	}
+}
+
+func TestSigningWaitsUntilNewKeyIsKnown(t *testing.T) {
+	ctx := context.Background()
+	signingKeys := &fakeSigningKeyRepo{}
+	tokens := service.TokenConfig{SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute}
+	s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{}, signingKeys,
+		tokens, service.RegistrationConfig{Open: true})
+
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	// The successor was created 90 seconds ago: every instance has loaded it, but a JWKS consumer
+	// may still hold a key set fetched before that.
+	old := signingKeys.keys[0]
+	old.CreatedAt = old.CreatedAt.Add(-5 * time.Minute)
+	successor := signingKeys.keys[0]
+	successor.ID = "successor"
+	successor.CreatedAt = successor.CreatedAt.Add(-90 * time.Second)
+	signingKeys.keys = []entity.SigningKey{successor, old}
+
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if err := s.Register(ctx, "alice", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	issued, err := s.Login(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(issued.AccessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if kid := token.Header["kid"]; kid != old.ID {
+		t.Errorf("access token kid = %v, want the older key %s", kid, old.ID)
+	}
+}
+
+func TestRotateKeysSkipsKeysThatCannotBeOpened(t *testing.T) {
+	ctx := context.Background()
+	signingKeys := &fakeSigningKeyRepo{}
+	tokens := service.TokenConfig{SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute}
+	s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{}, signingKeys,
+		tokens, service.RegistrationConfig{Open: true})
+
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	broken := signingKeys.keys[0]
+	broken.ID = "broken"
+	broken.PrivateKey = []byte("sealed under another secret")
+	signingKeys.keys = append(signingKeys.keys, broken)
+
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys with a broken key: %v", err)
+	}
+	if jwks := s.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid == "broken" {
+		t.Errorf("JWKS = %+v, want only the key that opens", jwks.Keys)
+	}
+
+}
+
+func TestRotateKeysReplacesKeysThatCannotBeOpened(t *testing.T) {
+	ctx := context.Background()
+	signingKeys := &fakeSigningKeyRepo{}
+	tokens := service.TokenConfig{SignKey: "old", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute}
+	s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{}, signingKeys,
+		tokens, service.RegistrationConfig{Open: true})
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	sealedWithOldKey := signingKeys.keys[0].ID
+
+	// The keys stored before JWT_SIGN_KEY changed are not due for rotation, but cannot be opened.
+	tokens.SignKey = "new"
+	s = newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{}, signingKeys,
+		tokens, service.RegistrationConfig{Open: true})
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys after the secret changed: %v", err)
+	}
+
+	if len(signingKeys.keys) != 2 {
+		t.Fatalf("stored keys = %d, want a new key next to the old one", len(signingKeys.keys))
+	}
+	if jwks := s.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid == sealedWithOldKey {
+		t.Errorf("JWKS = %+v, want only the new key", jwks.Keys)
+	}
+
+	if err := s.Register(ctx, "alice", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := s.Login(ctx, "alice", "secret"); err != nil {
+		t.Errorf("Login after the secret changed: %v", err)
+	}
+}
+
+func TestRotateKeysIgnoresNewestKeyThatCannotBeOpened(t *testing.T) {
+	ctx := context.Background()
+	signingKeys := &fakeSigningKeyRepo{}
+	tokens := service.TokenConfig{SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute}
+	s := newAuthServiceWithConfig(newFakeUserRepo(), newFakeRefreshTokenRepo(), &fakeRevocation{}, signingKeys,
+		tokens, service.RegistrationConfig{Open: true})
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	// The usable key is due for rotation, and the newer key that would otherwise postpone it is broken.
+	usable := signingKeys.keys[0]
+	usable.CreatedAt = usable.CreatedAt.Add(-2 * time.Hour)
+	usable.ExpiresAt = usable.ExpiresAt.Add(time.Hour)
+	broken := signingKeys.keys[0]
+	broken.ID = "broken"
+	broken.PrivateKey = []byte("sealed under another secret")
+	signingKeys.keys = []entity.SigningKey{broken, usable}
+
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if len(signingKeys.keys) != 3 {
+		t.Errorf("stored keys = %d, want a new key besides the broken and the due one", len(signingKeys.keys))
+	}
+}
@@ -2,71 +2,426 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
 	"time"
 
 	"github.com/realPointer/banners/internal/entity"
 	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/pkg/logger"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
 )
 
+type BannerCacheConfig struct {
+	// Enabled turns caching of user banners on. Without it every request reads the database.
+	Enabled bool
+	// TTL is how long a cached banner is served as fresh, unless its feature overrides it.
+	TTL time.Duration
+	// Jitter randomly shifts each TTL by up to this fraction of it, so keys cached together expire apart.
+	Jitter float64
+	// StaleTTL is how long past TTL a cached banner is still served while it is reloaded in the background.
+	StaleTTL time.Duration
+	// EarlyRefreshBeta scales how eagerly cached banners are reloaded before they expire. Zero disables early refresh.
+	EarlyRefreshBeta float64
+	// NotFoundTTL is how long a missing feature/tag pair is remembered. Zero disables negative caching.
+	NotFoundTTL time.Duration
+	// WarmUpBatchSize is how many feature/tag pairs a cache warm-up loads and writes at a time.
+	WarmUpBatchSize int
+}
+
+// ttls returns how long banner stays fresh in the cache and when it is evicted. A zero TTL
+// override turns caching off for the feature. A cached banner must not be served, even stale,
+// past its activation window.
+func (c BannerCacheConfig) ttls(banner *entity.UserBanner) (ttl, hardTTL time.Duration) {
+	ttl = c.TTL
+	if banner.CacheTTL != nil {
+		ttl = *banner.CacheTTL
+	}
+	if ttl <= 0 {
+		return 0, 0
+	}
+
+	if c.Jitter > 0 {
+		ttl += time.Duration((2*rand.Float64() - 1) * c.Jitter * float64(ttl))
+	}
+
+	hardTTL = ttl + c.StaleTTL
+	if banner.ActiveUntil != nil {
+		hardTTL = min(hardTTL, time.Until(*banner.ActiveUntil))
+		ttl = min(ttl, hardTTL)
+	}
+
+	return ttl, hardTTL
+}
+
 type BannerService struct {
-	bannerRepo repository.Banner
-	cacheRepo  repository.Cache
-	l          *zerolog.Logger
+	bannerRepo  repository.Banner
+	cacheRepo   repository.Cache
+	jobRepo     repository.Job
+	cache       *cacheInvalidator
+	cacheConfig BannerCacheConfig
+	loads       singleflight.Group
+	l           *zerolog.Logger
 }
 
-func NewBannerService(l *zerolog.Logger, bannerRepo repository.Banner, cacheRepo repository.Cache) *BannerService {
+func NewBannerService(
+	l *zerolog.Logger, bannerRepo repository.Banner, cacheRepo repository.Cache,
+	invalidationRepo repository.Invalidation, jobRepo repository.Job, cacheConfig BannerCacheConfig,
+) *BannerService {
 	return &BannerService{
-		bannerRepo: bannerRepo,
-		cacheRepo:  cacheRepo,
-		l:          l,
+		bannerRepo:  bannerRepo,
+		cacheRepo:   cacheRepo,
+		jobRepo:     jobRepo,
+		cache:       newCacheInvalidator(l, bannerRepo, cacheRepo, invalidationRepo),
+		cacheConfig: cacheConfig,
+		l:           l,
 	}
 }
 
-func (s *BannerService) GetBanner(ctx context.Context, tagID, featureID int, useLastRevision bool) (string, error) {
-	cacheKey := fmt.Sprintf("banner:%d:%d", tagID, featureID)
+func (s *BannerService) GetBanner(
+	ctx context.Context, tagID, featureID int, version *int, subjectKey string, useLastRevision bool,
+) (string, error) {
+	ctx, span := _tracer.Start(ctx, "BannerService.GetBanner")
+	defer span.End()
+
+	banner, err := s.getUserBanner(ctx, tagID, featureID, version, useLastRevision)
+	if err != nil {
+		return "", err
+	}
+
+	return string(selectContent(banner, subjectKey)), nil
+}
 
-	if !useLastRevision {
-		cachedData, err := s.cacheRepo.Get(ctx, cacheKey)
-		if err == nil && cachedData != "" {
-			return cachedData, nil
+func (s *BannerService) getUserBanner(
+	ctx context.Context, tagID, featureID int, version *int, useLastRevision bool,
+) (*entity.UserBanner, error) {
+	cacheKey := bannerCacheKey(tagID, featureID)
+	if version != nil {
+		cacheKey = bannerVersionCacheKey(tagID, featureID, *version)
+	}
+
+	if useLastRevision || !s.cacheConfig.Enabled {
+		_cacheCounters.bypass()
+		return s.loadBanner(ctx, cacheKey, tagID, featureID, version)
+	}
+
+	if cached, ok := s.getCached(ctx, cacheKey); ok {
+		// A stale or soon to expire banner is still served, and a single background load refreshes it.
+		// The load is detached from the request, so the response never waits for the database.
+		if s.refreshEarly(cached) {
+			s.loads.DoChan(cacheKey, func() (interface{}, error) {
+				return s.loadBanner(context.WithoutCancel(ctx), cacheKey, tagID, featureID, version)
+			})
 		}
+
+		if cached.NotFound {
+			return nil, postgresrepo.ErrBannerNotFound
+		}
+		return cached.Banner, nil
 	}
 
-	data, err := s.bannerRepo.GetBanner(ctx, tagID, featureID)
+	// Concurrent misses for the same key share a single database query. The query is detached from
+	// the caller that started it, so its cancellation does not fail the requests waiting on it.
+	result, err, _ := s.loads.Do(cacheKey, func() (interface{}, error) {
+		return s.loadBanner(context.WithoutCancel(ctx), cacheKey, tagID, featureID, version)
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	err = s.cacheRepo.Set(ctx, cacheKey, data, 5*time.Minute)
+	return result.(*entity.UserBanner), nil
+}
+
+func (s *BannerService) getCached(ctx context.Context, cacheKey string) (*cachedBanner, bool) {
+	cachedData, err := s.cacheRepo.Get(ctx, cacheKey)
 	if err != nil {
-		return "", err
+		_cacheCounters.error()
+		logCacheError(logger.FromContext(ctx, s.l), err, "BannerService.getCached - s.cacheRepo.Get")
+		return nil, false
+	}
+
+	if cachedData == "" {
+		_cacheCounters.miss()
+		return nil, false
+	}
+
+	var cached cachedBanner
+	if err := json.Unmarshal([]byte(cachedData), &cached); err != nil || (cached.Banner == nil && !cached.NotFound) {
+		_cacheCounters.miss()
+		return nil, false
+	}
+
+	// The local cache tier may keep an entry past the eviction time it was stored with, so a banner
+	// whose activation window has ended is reloaded instead of served. A missing pair is not served
+	// stale either, because a scheduled banner may have started in the meantime.
+	now := time.Now()
+	ended := cached.Banner != nil && cached.Banner.ActiveUntil != nil && !now.Before(*cached.Banner.ActiveUntil)
+	if ended || (cached.NotFound && !now.Before(cached.ExpiresAt)) {
+		_cacheCounters.miss()
+		return nil, false
 	}
 
-	return data, nil
+	_cacheCounters.hit()
+	return &cached, true
+}
+
+// refreshEarly decides whether a cached banner is reloaded. A stale banner always is. Before that
+// the chance grows as expiry approaches and with the time the last load took (probabilistic early
+// expiration), so a hot key is usually refreshed by a single request instead of all of them at expiry.
+func (s *BannerService) refreshEarly(cached *cachedBanner) bool {
+	if !time.Now().Before(cached.ExpiresAt) {
+		return true
+	}
+
+	if s.cacheConfig.EarlyRefreshBeta <= 0 {
+		return false
+	}
+
+	gap := time.Duration(float64(cached.Delta) * s.cacheConfig.EarlyRefreshBeta * -math.Log(1-rand.Float64()))
+
+	return time.Now().Add(gap).After(cached.ExpiresAt)
+}
+
+func (s *BannerService) loadBanner(
+	ctx context.Context, cacheKey string, tagID, featureID int, version *int,
+) (*entity.UserBanner, error) {
+	start := time.Now()
+
+	banner, err := s.bannerRepo.GetBanner(ctx, tagID, featureID, version)
+	if errors.Is(err, postgresrepo.ErrBannerNotFound) {
+		// Clients keep polling pairs that have no banner, so the miss is cached too. Writes that
+		// add a banner to the pair evict the entry like any other cached banner.
+		ttl := s.notFoundTTL(ctx, tagID, featureID)
+		s.storeCached(ctx, cacheKey, cachedBanner{NotFound: true, Delta: time.Since(start)}, ttl, ttl)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, hardTTL := s.cacheConfig.ttls(banner)
+	s.storeCached(ctx, cacheKey, cachedBanner{Banner: banner, Delta: time.Since(start)}, ttl, hardTTL)
+
+	return banner, nil
+}
+
+// notFoundTTL returns how long a missing feature/tag pair is cached. No write happens when a
+// scheduled banner of the pair becomes active, so the entry must expire by then.
+func (s *BannerService) notFoundTTL(ctx context.Context, tagID, featureID int) time.Duration {
+	ttl := s.cacheConfig.NotFoundTTL
+	if !s.cacheConfig.Enabled || ttl <= 0 {
+		return 0
+	}
+
+	activeFrom, err := s.bannerRepo.GetNextActivation(ctx, tagID, featureID)
+	if err != nil {
+		logger.FromContext(ctx, s.l).Err(err).Msg("BannerService.notFoundTTL - s.bannerRepo.GetNextActivation")
+		return 0
+	}
+
+	if activeFrom != nil {
+		ttl = min(ttl, time.Until(*activeFrom))
+	}
+
+	return ttl
+}
+
+// storeCached caches the result of a banner load. It is fresh for ttl and evicted after hardTTL.
+// The load itself succeeded, so a cache failure is only logged and costs a later database read.
+func (s *BannerService) storeCached(ctx context.Context, cacheKey string, cached cachedBanner, ttl, hardTTL time.Duration) {
+	if !s.cacheConfig.Enabled || hardTTL <= 0 {
+		return
+	}
+
+	data, err := encodeCachedBanner(cached, ttl)
+	if err != nil {
+		logger.FromContext(ctx, s.l).Err(err).Msg("BannerService.storeCached - encodeCachedBanner")
+		return
+	}
+
+	err = s.cacheRepo.Set(ctx, cacheKey, data, hardTTL)
+	if err != nil {
+		logCacheError(logger.FromContext(ctx, s.l), err, "BannerService.storeCached - s.cacheRepo.Set")
+	}
+}
+
+// selectContent picks the banner variant for subjectKey, weighting each variant by its share
+// of the total weight. The same subject always lands on the same variant of a banner as long
+// as the variant set is unchanged. Without variants or a subject the base content is returned.
+func selectContent(banner *entity.UserBanner, subjectKey string) json.RawMessage {
+	if len(banner.Variants) == 0 || subjectKey == "" {
+		return banner.Content
+	}
+
+	var totalWeight uint64
+	for _, variant := range banner.Variants {
+		totalWeight += uint64(variant.Weight)
+	}
+	if totalWeight == 0 {
+		return banner.Content
+	}
+
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%d:%s", banner.BannerID, subjectKey)
+	point := uint64(h.Sum32()) % totalWeight
+
+	for _, variant := range banner.Variants {
+		if point < uint64(variant.Weight) {
+			return variant.Content
+		}
+		point -= uint64(variant.Weight)
+	}
+
+	return banner.Content
 }
 
 func (s *BannerService) GetBanners(ctx context.Context, filter *entity.BannerFilter) ([]entity.BannerInfo, error) {
-	return s.bannerRepo.GetBanners(ctx, filter.FeatureID, filter.TagID, filter.Limit, filter.Offset)
+	ctx, span := _tracer.Start(ctx, "BannerService.GetBanners")
+	defer span.End()
+
+	return s.bannerRepo.GetBanners(ctx, filter.FeatureID, filter.TagID, filter.Limit, filter.Offset, filter.Deleted)
 }
 
 func (s *BannerService) CreateBanner(ctx context.Context, banner *entity.BannerCreate) (int, error) {
-	return s.bannerRepo.CreateBanner(ctx, banner.TagIDs, *banner.FeatureID, banner.Content, banner.IsActive)
+	ctx, span := _tracer.Start(ctx, "BannerService.CreateBanner")
+	defer span.End()
+
+	bannerID, err := s.bannerRepo.CreateBanner(
+		ctx, banner.TagIDs, *banner.FeatureID, banner.Content, banner.Variants, banner.IsActive, banner.ActiveFrom, banner.ActiveUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// The feature/tag pairs may still be cached for a banner that was deleted earlier.
+	s.cache.invalidateBanners(ctx, bannerID)
+
+	return bannerID, nil
 }
 
 func (s *BannerService) UpdateBanner(ctx context.Context, bannerID int, update *entity.BannerUpdate) error {
-	return s.bannerRepo.UpdateBanner(ctx, bannerID, update.TagIDs, update.FeatureID, update.Content, update.IsActive)
+	ctx, span := _tracer.Start(ctx, "BannerService.UpdateBanner")
+	defer span.End()
+
+	keys := s.cache.keys(ctx, bannerID)
+
+	err := s.bannerRepo.UpdateBanner(
+		ctx, bannerID, update.TagIDs, update.FeatureID, update.Content, update.Variants, update.IsActive,
+		update.ActiveFrom, update.ActiveUntil,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The update may have moved the banner, so both the old and the new pairs are evicted.
+	keys = append(keys, s.cache.keys(ctx, bannerID)...)
+	s.cache.invalidate(ctx, keys...)
+
+	return nil
+}
+
+func (s *BannerService) DeleteBanner(ctx context.Context, bannerID int, deletedBy string, hard bool) error {
+	ctx, span := _tracer.Start(ctx, "BannerService.DeleteBanner")
+	defer span.End()
+
+	keys := s.cache.keys(ctx, bannerID)
+
+	err := s.bannerRepo.DeleteBanner(ctx, bannerID, deletedBy, hard)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidate(ctx, keys...)
+
+	return nil
 }
 
-func (s *BannerService) DeleteBanner(ctx context.Context, bannerID int) error {
-	return s.bannerRepo.DeleteBanner(ctx, bannerID)
+func (s *BannerService) DeleteBannersByFeatureID(ctx context.Context, featureID int, deletedBy string) (int, error) {
+	ctx, span := _tracer.Start(ctx, "BannerService.DeleteBannersByFeatureID")
+	defer span.End()
+
+	return s.jobRepo.CreateJob(ctx, entity.JobKindDeleteByFeature, featureID, deletedBy)
 }
 
-func (s *BannerService) DeleteBannersByFeatureID(ctx context.Context, featureID int) error {
-	return s.bannerRepo.DeleteBannersByFeatureID(ctx, featureID)
+func (s *BannerService) DeleteBannersByTagID(ctx context.Context, tagID int, deletedBy string) (int, error) {
+	ctx, span := _tracer.Start(ctx, "BannerService.DeleteBannersByTagID")
+	defer span.End()
+
+	return s.jobRepo.CreateJob(ctx, entity.JobKindDeleteByTag, tagID, deletedBy)
 }
 
-func (s *BannerService) DeleteBannersByTagID(ctx context.Context, tagID int) error {
-	return s.bannerRepo.DeleteBannersByTagID(ctx, tagID)
+func (s *BannerService) GetBannerVersions(ctx context.Context, bannerID int) ([]entity.BannerVersion, error) {
+	ctx, span := _tracer.Start(ctx, "BannerService.GetBannerVersions")
+	defer span.End()
+
+	return s.bannerRepo.GetBannerVersions(ctx, bannerID)
+}
+
+func (s *BannerService) GetBannerVersion(ctx context.Context, bannerID, version int) (*entity.BannerVersion, error) {
+	ctx, span := _tracer.Start(ctx, "BannerService.GetBannerVersion")
+	defer span.End()
+
+	return s.bannerRepo.GetBannerVersion(ctx, bannerID, version)
+}
+
+func (s *BannerService) RollbackBanner(ctx context.Context, bannerID, version int) error {
+	ctx, span := _tracer.Start(ctx, "BannerService.RollbackBanner")
+	defer span.End()
+
+	err := s.bannerRepo.RollbackBanner(ctx, bannerID, version)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateBanners(ctx, bannerID)
+
+	return nil
+}
+
+func (s *BannerService) PinBannerVersion(ctx context.Context, bannerID, version int) error {
+	ctx, span := _tracer.Start(ctx, "BannerService.PinBannerVersion")
+	defer span.End()
+
+	err := s.bannerRepo.SetPinnedVersion(ctx, bannerID, &version)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateBanners(ctx, bannerID)
+
+	return nil
+}
+
+func (s *BannerService) UnpinBannerVersion(ctx context.Context, bannerID int) error {
+	ctx, span := _tracer.Start(ctx, "BannerService.UnpinBannerVersion")
+	defer span.End()
+
+	err := s.bannerRepo.SetPinnedVersion(ctx, bannerID, nil)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateBanners(ctx, bannerID)
+
+	return nil
+}
+
+func (s *BannerService) RestoreBanner(ctx context.Context, bannerID int) error {
+	ctx, span := _tracer.Start(ctx, "BannerService.RestoreBanner")
+	defer span.End()
+
+	err := s.bannerRepo.RestoreBanner(ctx, bannerID)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateBanners(ctx, bannerID)
+
+	return nil
 }
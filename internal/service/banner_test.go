@@ -0,0 +1,922 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+type fakeCache struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{data: make(map[string]string)}
+}
+
+func (c *fakeCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data[key], nil
+}
+
+func (c *fakeCache) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch v := value.(type) {
+	case []byte:
+		c.data[key] = string(v)
+	case string:
+		c.data[key] = v
+	default:
+		return errors.New("unsupported value type")
+	}
+	return nil
+}
+
+func (c *fakeCache) SetMany(_ context.Context, items []entity.CacheItem) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range items {
+		c.data[item.Key] = string(item.Value)
+	}
+	return nil
+}
+
+func (c *fakeCache) Keys(_ context.Context, pattern string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+	for key := range c.data {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (c *fakeCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.data, key)
+	}
+	return nil
+}
+
+func (c *fakeCache) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.data))
+	for key := range c.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fakeInvalidation records published keys. Subscribe panics through the nil embedded interface.
+type fakeInvalidation struct {
+	repository.Invalidation
+
+	mu        sync.Mutex
+	published []string
+}
+
+func (i *fakeInvalidation) Publish(_ context.Context, keys ...string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.published = append(i.published, keys...)
+	return nil
+}
+
+type fakeBanner struct {
+	featureID  int
+	tagIDs     []int
+	content    string
+	maxVersion int
+	// versions holds the content of the versions before maxVersion, whose content is content.
+	versions      map[int]string
+	pinnedVersion *int
+	cacheTTL      *time.Duration
+	variants      []entity.BannerVariant
+	deleted       bool
+	// activeFrom and activeUntil hide the banner outside of its activation window.
+	activeFrom  *time.Time
+	activeUntil *time.Time
+}
+
+// contentAt returns the content of a version of the banner.
+func (b *fakeBanner) contentAt(version int) (string, bool) {
+	if version == b.maxVersion {
+		return b.content, true
+	}
+	content, ok := b.versions[version]
+	return content, ok
+}
+
+func (b *fakeBanner) active(now time.Time) bool {
+	return !b.deleted && (b.activeFrom == nil || !now.Before(*b.activeFrom)) &&
+		(b.activeUntil == nil || now.Before(*b.activeUntil))
+}
+
+// fakeBannerRepo keeps banners in memory. Methods the tests don't use panic through the nil embedded interface.
+type fakeBannerRepo struct {
+	repository.Banner
+
+	mu        sync.Mutex
+	banners   map[int]*fakeBanner
+	nextID    int
+	getCalls  int
+	getDelay  time.Duration
+	updateErr error
+	deleteErr error
+	// purges are the counts PurgeDeletedBanners returns, one per call.
+	purges     []int
+	purgeCalls int
+}
+
+func newFakeBannerRepo() *fakeBannerRepo {
+	return &fakeBannerRepo{banners: make(map[int]*fakeBanner), nextID: 1}
+}
+
+// GetBanner serves the requested version of the banner, or else its pinned or latest one.
+func (r *fakeBannerRepo) GetBanner(_ context.Context, tagID, featureID int, version *int) (*entity.UserBanner, error) {
+	time.Sleep(r.getDelay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.getCalls++
+	for id, b := range r.banners {
+		if b.featureID != featureID || !b.active(time.Now()) {
+			continue
+		}
+		if !slices.Contains(b.tagIDs, tagID) {
+			continue
+		}
+
+		served := b.maxVersion
+		if version != nil {
+			served = *version
+		} else if b.pinnedVersion != nil {
+			served = *b.pinnedVersion
+		}
+
+		content, ok := b.contentAt(served)
+		if !ok {
+			break
+		}
+		return &entity.UserBanner{
+			BannerID: id, Content: json.RawMessage(content), Variants: b.variants,
+			ActiveUntil: b.activeUntil, CacheTTL: b.cacheTTL,
+		}, nil
+	}
+	return nil, postgresrepo.ErrBannerNotFound
+}
+
+func (r *fakeBannerRepo) GetNextActivation(_ context.Context, tagID, featureID int) (*time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, b := range r.banners {
+		if b.featureID == featureID && slices.Contains(b.tagIDs, tagID) && !b.deleted &&
+			b.activeFrom != nil && time.Now().Before(*b.activeFrom) {
+			return b.activeFrom, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeBannerRepo) calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.getCalls
+}
+
+func (r *fakeBannerRepo) CreateBanner(
+	_ context.Context, tagIDs []int, featureID int, content json.RawMessage, _ []entity.BannerVariant, _ bool, _, _ *time.Time,
+) (int, error) {
+	id := r.nextID
+	r.nextID++
+	r.banners[id] = &fakeBanner{featureID: featureID, tagIDs: tagIDs, content: string(content), maxVersion: 1}
+	return id, nil
+}
+
+func (r *fakeBannerRepo) UpdateBanner(
+	_ context.Context, bannerID int, tagIDs []int, featureID *int, content json.RawMessage, variants []entity.BannerVariant,
+	_ *bool, _, _ entity.NullableTime,
+) error {
+	if r.updateErr != nil {
+		return r.updateErr
+	}
+
+	b, ok := r.banners[bannerID]
+	if !ok {
+		return postgresrepo.ErrBannerNotFound
+	}
+	if len(tagIDs) > 0 {
+		b.tagIDs = tagIDs
+	}
+	if featureID != nil {
+		b.featureID = *featureID
+	}
+	if content != nil || variants != nil {
+		if b.versions == nil {
+			b.versions = make(map[int]string)
+		}
+		b.versions[b.maxVersion] = b.content
+		b.maxVersion++
+	}
+	if content != nil {
+		b.content = string(content)
+	}
+	if variants != nil {
+		b.variants = variants
+	}
+	return nil
+}
+
+func (r *fakeBannerRepo) SetPinnedVersion(_ context.Context, bannerID int, version *int) error {
+	b, ok := r.banners[bannerID]
+	if !ok {
+		return postgresrepo.ErrBannerNotFound
+	}
+	if version != nil {
+		if _, ok := b.contentAt(*version); !ok {
+			return postgresrepo.ErrBannerVersionNotFound
+		}
+	}
+	b.pinnedVersion = version
+	return nil
+}
+
+func (r *fakeBannerRepo) DeleteBanner(_ context.Context, bannerID int, _ string, _ bool) error {
+	if _, ok := r.banners[bannerID]; !ok {
+		return postgresrepo.ErrBannerNotFound
+	}
+	delete(r.banners, bannerID)
+	return nil
+}
+
+func (r *fakeBannerRepo) GetFeatureTags(_ context.Context, bannerIDs []int) ([]entity.FeatureTag, error) {
+	var featureTags []entity.FeatureTag
+	for _, id := range bannerIDs {
+		b, ok := r.banners[id]
+		if !ok {
+			continue
+		}
+		for _, t := range b.tagIDs {
+			featureTags = append(featureTags, entity.FeatureTag{FeatureID: b.featureID, TagID: t})
+		}
+	}
+	return featureTags, nil
+}
+
+// GetActiveBanners pages through the banners ordered by ID, using the banner ID as the feature ID.
+func (r *fakeBannerRepo) GetActiveBanners(
+	_ context.Context, after *entity.FeatureTag, limit int,
+) ([]entity.ActiveBanner, error) {
+	ids := make([]int, 0, len(r.banners))
+	for id := range r.banners {
+		if after == nil || id > after.FeatureID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	var banners []entity.ActiveBanner
+	for _, id := range ids[:min(limit, len(ids))] {
+		b := r.banners[id]
+		banners = append(banners, entity.ActiveBanner{
+			FeatureID: id,
+			TagID:     b.tagIDs[0],
+			Banner:    entity.UserBanner{BannerID: id, Content: json.RawMessage(b.content)},
+		})
+	}
+	return banners, nil
+}
+
+func newBannerService(repo *fakeBannerRepo, cache *fakeCache) *service.BannerService {
+	return newBannerServiceWithInvalidation(repo, cache, &fakeInvalidation{})
+}
+
+func newBannerServiceWithInvalidation(
+	repo *fakeBannerRepo, cache *fakeCache, invalidation *fakeInvalidation,
+) *service.BannerService {
+	l := zerolog.Nop()
+	return service.NewBannerService(&l, repo, cache, invalidation, nil, service.BannerCacheConfig{Enabled: true, TTL: time.Minute})
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestGetBannerServesFromCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{"title":"a"}`, maxVersion: 1}
+
+	for range 2 {
+		content, err := s.GetBanner(ctx, 1, 1, nil, "", false)
+		if err != nil {
+			t.Fatalf("GetBanner: %v", err)
+		}
+		if content != `{"title":"a"}` {
+			t.Errorf("GetBanner content = %s, want %s", content, `{"title":"a"}`)
+		}
+	}
+
+	if repo.getCalls != 1 {
+		t.Errorf("repository calls = %d, want 1", repo.getCalls)
+	}
+}
+
+func TestGetBannerHonorsFeatureTTLOverride(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	noCache := time.Duration(0)
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, cacheTTL: &noCache}
+
+	for range 2 {
+		if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+			t.Fatalf("GetBanner: %v", err)
+		}
+	}
+
+	if repo.getCalls != 2 {
+		t.Errorf("repository calls = %d, want 2", repo.getCalls)
+	}
+	if got := cache.keys(); len(got) != 0 {
+		t.Errorf("cache keys = %v, want none", got)
+	}
+}
+
+// versionedBanner is a banner with two versions, the second of which users see.
+func versionedBanner() *fakeBanner {
+	return &fakeBanner{
+		featureID: 1, tagIDs: []int{1}, content: `{"title":"v2"}`, maxVersion: 2,
+		versions: map[int]string{1: `{"title":"v1"}`},
+	}
+}
+
+func expectContent(t *testing.T, s *service.BannerService, version *int, want string) {
+	t.Helper()
+
+	content, err := s.GetBanner(context.Background(), 1, 1, version, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner(version %v): %v", version, err)
+	}
+	if content != want {
+		t.Errorf("GetBanner(version %v) content = %s, want %s", version, content, want)
+	}
+}
+
+func TestGetBannerCachesVersionsSeparately(t *testing.T) {
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = versionedBanner()
+
+	for range 2 {
+		expectContent(t, s, intPtr(1), `{"title":"v1"}`)
+		expectContent(t, s, nil, `{"title":"v2"}`)
+		expectContent(t, s, intPtr(2), `{"title":"v2"}`)
+	}
+
+	if repo.getCalls != 3 {
+		t.Errorf("repository calls = %d, want 3", repo.getCalls)
+	}
+
+	want := []string{"banner:1:1", "banner:1:1:v1", "banner:1:1:v2"}
+	if got := cache.keys(); !slices.Equal(got, want) {
+		t.Errorf("cache keys = %v, want %v", got, want)
+	}
+
+	if _, err := s.GetBanner(context.Background(), 1, 1, intPtr(3), "", false); !errors.Is(err, postgresrepo.ErrBannerNotFound) {
+		t.Errorf("GetBanner(version 3) error = %v, want %v", err, postgresrepo.ErrBannerNotFound)
+	}
+}
+
+func TestPinBannerVersionServesPinnedVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = versionedBanner()
+
+	expectContent(t, s, nil, `{"title":"v2"}`)
+	expectContent(t, s, intPtr(1), `{"title":"v1"}`)
+
+	if err := s.PinBannerVersion(ctx, 1, 1); err != nil {
+		t.Fatalf("PinBannerVersion: %v", err)
+	}
+
+	if got := cache.keys(); len(got) != 0 {
+		t.Errorf("cache keys after pin = %v, want none", got)
+	}
+	expectContent(t, s, nil, `{"title":"v1"}`)
+	expectContent(t, s, intPtr(2), `{"title":"v2"}`)
+
+	if err := s.UnpinBannerVersion(ctx, 1); err != nil {
+		t.Fatalf("UnpinBannerVersion: %v", err)
+	}
+
+	if got := cache.keys(); len(got) != 0 {
+		t.Errorf("cache keys after unpin = %v, want none", got)
+	}
+	expectContent(t, s, nil, `{"title":"v2"}`)
+}
+
+func TestPinBannerVersionKeepsCacheForMissingVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = versionedBanner()
+	expectContent(t, s, nil, `{"title":"v2"}`)
+
+	if err := s.PinBannerVersion(ctx, 1, 3); !errors.Is(err, postgresrepo.ErrBannerVersionNotFound) {
+		t.Fatalf("PinBannerVersion error = %v, want %v", err, postgresrepo.ErrBannerVersionNotFound)
+	}
+
+	if got := cache.keys(); len(got) != 1 {
+		t.Errorf("cache keys after failed pin = %v, want [banner:1:1]", got)
+	}
+}
+
+func TestUpdateBannerInvalidatesCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{"title":"a"}`, maxVersion: 1}
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+
+	err := s.UpdateBanner(ctx, 1, &entity.BannerUpdate{Content: json.RawMessage(`{"title":"b"}`)})
+	if err != nil {
+		t.Fatalf("UpdateBanner: %v", err)
+	}
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `{"title":"b"}` {
+		t.Errorf("GetBanner content = %s, want %s", content, `{"title":"b"}`)
+	}
+}
+
+func TestUpdateBannerInvalidatesOldAndNewPairs(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1, 2}, content: `{}`, maxVersion: 2}
+
+	for _, key := range []string{"banner:1:1", "banner:2:1", "banner:1:1:v1", "banner:2:1:v2", "banner:3:2", "banner:9:9"} {
+		_ = cache.Set(ctx, key, "cached", time.Minute)
+	}
+
+	err := s.UpdateBanner(ctx, 1, &entity.BannerUpdate{TagIDs: []int{3}, FeatureID: intPtr(2)})
+	if err != nil {
+		t.Fatalf("UpdateBanner: %v", err)
+	}
+
+	got := cache.keys()
+	if len(got) != 1 || got[0] != "banner:9:9" {
+		t.Errorf("cache keys after update = %v, want [banner:9:9]", got)
+	}
+}
+
+func TestUpdateBannerKeepsCacheOnError(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1}
+	repo.updateErr = errors.New("update failed")
+	_ = cache.Set(ctx, "banner:1:1", "cached", time.Minute)
+
+	err := s.UpdateBanner(ctx, 1, &entity.BannerUpdate{IsActive: new(bool)})
+	if !errors.Is(err, repo.updateErr) {
+		t.Fatalf("UpdateBanner error = %v, want %v", err, repo.updateErr)
+	}
+
+	if got := cache.keys(); len(got) != 1 {
+		t.Errorf("cache keys after failed update = %v, want [banner:1:1]", got)
+	}
+}
+
+func TestDeleteBannerInvalidatesCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1, 2}, content: `{}`, maxVersion: 1}
+	for _, key := range []string{"banner:1:1", "banner:2:1", "banner:2:1:v1"} {
+		_ = cache.Set(ctx, key, "cached", time.Minute)
+	}
+
+	if err := s.DeleteBanner(ctx, 1, "admin", false); err != nil {
+		t.Fatalf("DeleteBanner: %v", err)
+	}
+
+	if got := cache.keys(); len(got) != 0 {
+		t.Errorf("cache keys after delete = %v, want none", got)
+	}
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); !errors.Is(err, postgresrepo.ErrBannerNotFound) {
+		t.Errorf("GetBanner after delete error = %v, want %v", err, postgresrepo.ErrBannerNotFound)
+	}
+}
+
+func TestDeleteBannerPublishesInvalidation(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	invalidation := &fakeInvalidation{}
+	cache := newFakeCache()
+	s := newBannerServiceWithInvalidation(repo, cache, invalidation)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{2}, content: `{}`, maxVersion: 40}
+	_ = cache.Set(ctx, "banner:2:1:v3", "cached", time.Minute)
+
+	if err := s.DeleteBanner(ctx, 1, "admin", false); err != nil {
+		t.Fatalf("DeleteBanner: %v", err)
+	}
+
+	// Only the version keys found in the cache are evicted, however many versions the banner has.
+	sort.Strings(invalidation.published)
+	want := []string{"banner:2:1", "banner:2:1:v3"}
+	if !slices.Equal(invalidation.published, want) {
+		t.Errorf("published keys = %v, want %v", invalidation.published, want)
+	}
+}
+
+func TestCreateBannerInvalidatesStaleCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	_ = cache.Set(ctx, "banner:1:1", "stale", time.Minute)
+
+	_, err := s.CreateBanner(ctx, &entity.BannerCreate{
+		TagIDs:    []int{1},
+		FeatureID: intPtr(1),
+		Content:   json.RawMessage(`{"title":"new"}`),
+	})
+	if err != nil {
+		t.Fatalf("CreateBanner: %v", err)
+	}
+
+	if got := cache.keys(); len(got) != 0 {
+		t.Errorf("cache keys after create = %v, want none", got)
+	}
+}
+
+func TestGetBannerCoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{"title":"a"}`, maxVersion: 1}
+	repo.getDelay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+				t.Errorf("GetBanner: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if repo.getCalls != 1 {
+		t.Errorf("repository calls = %d, want 1", repo.getCalls)
+	}
+}
+
+// failingCache behaves like a cache whose backend is unreachable.
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+func (failingCache) Set(context.Context, string, interface{}, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingCache) SetMany(context.Context, []entity.CacheItem) error {
+	return errors.New("connection refused")
+}
+
+func (failingCache) Keys(context.Context, string) ([]string, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingCache) Delete(context.Context, ...string) error {
+	return errors.New("connection refused")
+}
+
+func TestGetBannerServesFromDatabaseWhenCacheFails(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	l := zerolog.Nop()
+	cfg := service.BannerCacheConfig{Enabled: true, TTL: time.Minute}
+	s := service.NewBannerService(&l, repo, failingCache{}, &fakeInvalidation{}, nil, cfg)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{"title":"a"}`, maxVersion: 1}
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `{"title":"a"}` {
+		t.Errorf("GetBanner content = %s, want %s", content, `{"title":"a"}`)
+	}
+
+	if err := s.UpdateBanner(ctx, 1, &entity.BannerUpdate{Content: json.RawMessage(`{"title":"b"}`)}); err != nil {
+		t.Errorf("UpdateBanner: %v", err)
+	}
+}
+
+func TestGetBannerCachesMissingPair(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	l := zerolog.Nop()
+	cfg := service.BannerCacheConfig{Enabled: true, TTL: time.Minute, NotFoundTTL: time.Minute}
+	s := service.NewBannerService(&l, repo, cache, &fakeInvalidation{}, nil, cfg)
+
+	for range 2 {
+		if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); !errors.Is(err, postgresrepo.ErrBannerNotFound) {
+			t.Fatalf("GetBanner error = %v, want %v", err, postgresrepo.ErrBannerNotFound)
+		}
+	}
+	if repo.getCalls != 1 {
+		t.Errorf("repository calls = %d, want 1", repo.getCalls)
+	}
+
+	_, err := s.CreateBanner(ctx, &entity.BannerCreate{
+		TagIDs:    []int{1},
+		FeatureID: intPtr(1),
+		Content:   json.RawMessage(`{"title":"new"}`),
+	})
+	if err != nil {
+		t.Fatalf("CreateBanner: %v", err)
+	}
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner after create: %v", err)
+	}
+	if content != `{"title":"new"}` {
+		t.Errorf("GetBanner content = %s, want %s", content, `{"title":"new"}`)
+	}
+}
+
+func TestGetBannerServesStaleWhileRefreshing(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	l := zerolog.Nop()
+	cfg := service.BannerCacheConfig{Enabled: true, TTL: time.Millisecond, StaleTTL: time.Minute}
+	s := service.NewBannerService(&l, repo, cache, &fakeInvalidation{}, nil, cfg)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{"title":"a"}`, maxVersion: 1}
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+
+	repo.mu.Lock()
+	repo.banners[1].content = `{"title":"b"}`
+	repo.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `{"title":"a"}` {
+		t.Errorf("stale GetBanner content = %s, want %s", content, `{"title":"a"}`)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for repo.calls() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	content, err = s.GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `{"title":"b"}` {
+		t.Errorf("refreshed GetBanner content = %s, want %s", content, `{"title":"b"}`)
+	}
+}
+
+func TestGetBannerSelectsVariantWithLargeWeights(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	s := newBannerService(repo, newFakeCache())
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, variants: []entity.BannerVariant{
+		{Name: "a", Weight: math.MaxInt32, Content: json.RawMessage(`"a"`)},
+		{Name: "b", Weight: math.MaxInt32, Content: json.RawMessage(`"b"`)},
+		{Name: "c", Weight: 2, Content: json.RawMessage(`"c"`)},
+	}}
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "user-1", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content == `{}` {
+		t.Errorf("GetBanner content = %s, want a variant", content)
+	}
+}
+
+func abVariants(weightA, weightB int) []entity.BannerVariant {
+	return []entity.BannerVariant{
+		{Name: "a", Weight: weightA, Content: json.RawMessage(`"a"`)},
+		{Name: "b", Weight: weightB, Content: json.RawMessage(`"b"`)},
+	}
+}
+
+func TestGetBannerSelectsVariantDeterministically(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, variants: abVariants(1, 1)}
+
+	first := make(map[string]string)
+	for _, s := range []*service.BannerService{newBannerService(repo, newFakeCache()), newBannerService(repo, newFakeCache())} {
+		for i := range 100 {
+			subject := fmt.Sprintf("user-%d", i)
+
+			content, err := s.GetBanner(ctx, 1, 1, nil, subject, false)
+			if err != nil {
+				t.Fatalf("GetBanner: %v", err)
+			}
+
+			if want, ok := first[subject]; ok && content != want {
+				t.Fatalf("subject %s got variant %s, then %s", subject, want, content)
+			}
+			first[subject] = content
+		}
+	}
+
+	content, err := newBannerService(repo, newFakeCache()).GetBanner(ctx, 1, 1, nil, "", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `{}` {
+		t.Errorf("GetBanner content without subject = %s, want %s", content, `{}`)
+	}
+}
+
+func TestGetBannerSplitsSubjectsByWeight(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	s := newBannerService(repo, newFakeCache())
+
+	tests := []struct {
+		name             string
+		weightA, weightB int
+		wantA            float64
+	}{
+		{name: "even", weightA: 50, weightB: 50, wantA: 0.5},
+		{name: "skewed", weightA: 90, weightB: 10, wantA: 0.9},
+		{name: "large weights", weightA: 750_000, weightB: 250_000, wantA: 0.75},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := i + 1
+			repo.banners[id] = &fakeBanner{
+				featureID: id, tagIDs: []int{1}, content: `{}`, maxVersion: 1, variants: abVariants(tt.weightA, tt.weightB),
+			}
+
+			const subjects = 10000
+			a := 0
+			for j := range subjects {
+				content, err := s.GetBanner(ctx, 1, id, nil, fmt.Sprintf("user-%d", j), false)
+				if err != nil {
+					t.Fatalf("GetBanner: %v", err)
+				}
+				if content == `"a"` {
+					a++
+				}
+			}
+
+			if got := float64(a) / subjects; math.Abs(got-tt.wantA) > 0.03 {
+				t.Errorf("share of variant a = %.3f, want %.2f", got, tt.wantA)
+			}
+		})
+	}
+}
+
+func TestUpdateBannerVariantsInvalidatesCache(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	s := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, variants: abVariants(1, 1)[:1]}
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "user-1", false); err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+
+	err := s.UpdateBanner(ctx, 1, &entity.BannerUpdate{Variants: abVariants(1, 1)[1:]})
+	if err != nil {
+		t.Fatalf("UpdateBanner: %v", err)
+	}
+
+	content, err := s.GetBanner(ctx, 1, 1, nil, "user-1", false)
+	if err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if content != `"b"` {
+		t.Errorf("GetBanner content after variants update = %s, want %s", content, `"b"`)
+	}
+}
+
+func TestGetBannerDropsCachedBannerPastActiveUntil(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	// fakeCache keeps entries past their expiration, like the local tier can.
+	s := newBannerService(repo, newFakeCache())
+
+	activeUntil := time.Now().Add(20 * time.Millisecond)
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, activeUntil: &activeUntil}
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+
+	time.Sleep(time.Until(activeUntil))
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); !errors.Is(err, postgresrepo.ErrBannerNotFound) {
+		t.Errorf("GetBanner past active_until error = %v, want %v", err, postgresrepo.ErrBannerNotFound)
+	}
+}
+
+func TestGetBannerCachesMissingPairUntilScheduledStart(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	l := zerolog.Nop()
+	cfg := service.BannerCacheConfig{Enabled: true, TTL: time.Minute, NotFoundTTL: time.Minute}
+	s := service.NewBannerService(&l, repo, newFakeCache(), &fakeInvalidation{}, nil, cfg)
+
+	activeFrom := time.Now().Add(20 * time.Millisecond)
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1, activeFrom: &activeFrom}
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); !errors.Is(err, postgresrepo.ErrBannerNotFound) {
+		t.Fatalf("GetBanner before active_from error = %v, want %v", err, postgresrepo.ErrBannerNotFound)
+	}
+
+	time.Sleep(time.Until(activeFrom))
+
+	if _, err := s.GetBanner(ctx, 1, 1, nil, "", false); err != nil {
+		t.Errorf("GetBanner after active_from: %v", err)
+	}
+}
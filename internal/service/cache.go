@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	"github.com/realPointer/banners/pkg/circuitbreaker"
+	"github.com/realPointer/banners/pkg/logger"
+	"github.com/rs/zerolog"
+)
+
+// _flushBatchSize is how many keys a flush deletes and broadcasts at a time.
+const _flushBatchSize = 1000
+
+// cachedBanner is the value stored under a banner cache key.
+type cachedBanner struct {
+	Banner *entity.UserBanner `json:"banner"`
+	// NotFound marks a feature/tag pair that has no banner to show.
+	NotFound bool `json:"not_found,omitempty"`
+	// ExpiresAt is when the banner turns stale. The cache entry itself lives longer.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Delta is how long loading the banner from the database took.
+	Delta time.Duration `json:"delta"`
+}
+
+// encodeCachedBanner serializes cached to be stored as fresh for ttl.
+func encodeCachedBanner(cached cachedBanner, ttl time.Duration) ([]byte, error) {
+	cached.ExpiresAt = time.Now().Add(ttl)
+	return json.Marshal(cached)
+}
+
+func bannerCacheKey(tagID, featureID int) string {
+	return fmt.Sprintf("banner:%d:%d", tagID, featureID)
+}
+
+func bannerVersionCacheKey(tagID, featureID, version int) string {
+	return fmt.Sprintf("%s:v%d", bannerCacheKey(tagID, featureID), version)
+}
+
+// bannerVersionCachePattern matches the keys of every pinned version cached for a feature/tag pair.
+func bannerVersionCachePattern(tagID, featureID int) string {
+	return bannerCacheKey(tagID, featureID) + ":v*"
+}
+
+// bannerCachePatterns returns the key patterns of every banner cached for a feature, a tag, both, or any.
+func bannerCachePatterns(featureID, tagID *int) []string {
+	tag, feature := "*", "*"
+	if tagID != nil {
+		tag = strconv.Itoa(*tagID)
+	}
+	if featureID != nil {
+		feature = strconv.Itoa(*featureID)
+	}
+
+	return []string{
+		fmt.Sprintf("banner:%s:%s", tag, feature),
+		fmt.Sprintf("banner:%s:%s:v*", tag, feature),
+	}
+}
+
+// logCacheError logs a failed cache call. Calls rejected by an open circuit breaker are only
+// logged at debug level, since the breaker already reported the outage when it opened.
+func logCacheError(l *zerolog.Logger, err error, msg string) {
+	if errors.Is(err, circuitbreaker.ErrOpen) {
+		l.Debug().Err(err).Msg(msg)
+		return
+	}
+
+	l.Warn().Err(err).Msg(msg)
+}
+
+// cacheInvalidator evicts the cached user banners affected by banner writes.
+type cacheInvalidator struct {
+	bannerRepo       repository.Banner
+	cacheRepo        repository.Cache
+	invalidationRepo repository.Invalidation
+	l                *zerolog.Logger
+}
+
+func newCacheInvalidator(
+	l *zerolog.Logger, bannerRepo repository.Banner, cacheRepo repository.Cache, invalidationRepo repository.Invalidation,
+) *cacheInvalidator {
+	return &cacheInvalidator{
+		bannerRepo:       bannerRepo,
+		cacheRepo:        cacheRepo,
+		invalidationRepo: invalidationRepo,
+		l:                l,
+	}
+}
+
+// keys returns the cache keys of the given banners as they are stored right now: the key of each
+// feature/tag pair, plus the version keys actually found in the cache for it.
+// Callers that change the feature/tag pairs of a banner collect them both before and after the write.
+func (c *cacheInvalidator) keys(ctx context.Context, bannerIDs ...int) []string {
+	if len(bannerIDs) == 0 {
+		return nil
+	}
+
+	featureTags, err := c.bannerRepo.GetFeatureTags(ctx, bannerIDs)
+	if err != nil {
+		logger.FromContext(ctx, c.l).Err(err).Ints("banner_ids", bannerIDs).
+			Msg("cacheInvalidator.keys - c.bannerRepo.GetFeatureTags")
+		return nil
+	}
+
+	var keys []string
+	for _, ft := range featureTags {
+		keys = append(keys, bannerCacheKey(ft.TagID, ft.FeatureID))
+
+		versionKeys, err := c.cacheRepo.Keys(ctx, bannerVersionCachePattern(ft.TagID, ft.FeatureID))
+		if err != nil {
+			logCacheError(logger.FromContext(ctx, c.l), err, "cacheInvalidator.keys - c.cacheRepo.Keys")
+			continue
+		}
+		keys = append(keys, versionKeys...)
+	}
+
+	return keys
+}
+
+// invalidate deletes keys from the cache and tells the other instances to drop them from their
+// local caches. The write it follows has already been committed, so a failure is logged rather
+// than reported to the caller.
+func (c *cacheInvalidator) invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := c.cacheRepo.Delete(ctx, keys...); err != nil {
+		logCacheError(logger.FromContext(ctx, c.l), err, "cacheInvalidator.invalidate - c.cacheRepo.Delete")
+	}
+
+	if err := c.invalidationRepo.Publish(ctx, keys...); err != nil {
+		logCacheError(logger.FromContext(ctx, c.l), err, "cacheInvalidator.invalidate - c.invalidationRepo.Publish")
+	}
+}
+
+// invalidateBanners evicts every key the given banners are currently cached under.
+func (c *cacheInvalidator) invalidateBanners(ctx context.Context, bannerIDs ...int) {
+	c.invalidate(ctx, c.keys(ctx, bannerIDs...)...)
+}
+
+type CacheService struct {
+	bannerRepo       repository.Banner
+	cacheRepo        repository.Cache
+	invalidationRepo repository.Invalidation
+	localCache       repository.LocalCache
+	cachePolicyRepo  repository.CachePolicy
+	cache            *cacheInvalidator
+	cacheConfig      BannerCacheConfig
+	l                *zerolog.Logger
+}
+
+func NewCacheService(
+	l *zerolog.Logger, bannerRepo repository.Banner, cacheRepo repository.Cache,
+	invalidationRepo repository.Invalidation, localCache repository.LocalCache,
+	cachePolicyRepo repository.CachePolicy, cacheConfig BannerCacheConfig,
+) *CacheService {
+	return &CacheService{
+		bannerRepo:       bannerRepo,
+		cacheRepo:        cacheRepo,
+		invalidationRepo: invalidationRepo,
+		localCache:       localCache,
+		cachePolicyRepo:  cachePolicyRepo,
+		cache:            newCacheInvalidator(l, bannerRepo, cacheRepo, invalidationRepo),
+		cacheConfig:      cacheConfig,
+		l:                l,
+	}
+}
+
+func (s *CacheService) GetFeatureTTLs(ctx context.Context) ([]entity.FeatureCacheTTL, error) {
+	return s.cachePolicyRepo.GetFeatureTTLs(ctx)
+}
+
+func (s *CacheService) SetFeatureTTL(ctx context.Context, featureID int, ttl time.Duration) error {
+	err := s.cachePolicyRepo.SetFeatureTTL(ctx, featureID, ttl)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateFeature(ctx, featureID)
+
+	return nil
+}
+
+func (s *CacheService) DeleteFeatureTTL(ctx context.Context, featureID int) error {
+	err := s.cachePolicyRepo.DeleteFeatureTTL(ctx, featureID)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateFeature(ctx, featureID)
+
+	return nil
+}
+
+// invalidateFeature evicts the banners of a feature, so they are cached again with its current TTL.
+// The keys are found by pattern, like Flush does, rather than by loading the banners of the feature.
+func (s *CacheService) invalidateFeature(ctx context.Context, featureID int) {
+	if _, err := s.Flush(ctx, &featureID, nil); err != nil {
+		logCacheError(logger.FromContext(ctx, s.l), err, "CacheService.invalidateFeature - s.Flush")
+	}
+}
+
+// Stats returns the lookup counters of this instance. Counting the cached keys scans the whole
+// Redis keyspace, so it is only done when countKeys is set.
+func (s *CacheService) Stats(ctx context.Context, countKeys bool) (*entity.CacheStats, error) {
+	stats := &entity.CacheStats{
+		Hits:     _cacheCounters.hits.Load(),
+		Misses:   _cacheCounters.misses.Load(),
+		Errors:   _cacheCounters.errors.Load(),
+		Bypasses: _cacheCounters.bypasses.Load(),
+	}
+
+	if lookups := stats.Hits + stats.Misses + stats.Errors; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+
+	if countKeys {
+		keys, err := s.keys(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		count := len(keys)
+		stats.Keys = &count
+	}
+
+	return stats, nil
+}
+
+// Flush evicts the cached banners of a feature, a tag, or both, or the whole banner cache
+// when neither is given, and returns the number of evicted keys.
+func (s *CacheService) Flush(ctx context.Context, featureID, tagID *int) (int, error) {
+	keys, err := s.keys(ctx, featureID, tagID)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(keys); start += _flushBatchSize {
+		batch := keys[start:min(start+_flushBatchSize, len(keys))]
+
+		if err := s.cacheRepo.Delete(ctx, batch...); err != nil {
+			return 0, err
+		}
+
+		if err := s.invalidationRepo.Publish(ctx, batch...); err != nil {
+			logCacheError(logger.FromContext(ctx, s.l), err, "CacheService.Flush - s.invalidationRepo.Publish")
+		}
+	}
+
+	return len(keys), nil
+}
+
+// keys lists the cached banner keys of a feature, a tag, both, or all of them.
+func (s *CacheService) keys(ctx context.Context, featureID, tagID *int) ([]string, error) {
+	seen := make(map[string]struct{})
+	var keys []string
+
+	for _, pattern := range bannerCachePatterns(featureID, tagID) {
+		matched, err := s.cacheRepo.Keys(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range matched {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// WarmUp caches every banner users currently see under its feature/tag pair and returns
+// how many pairs were cached. Pairs are loaded and written WarmUpBatchSize at a time.
+func (s *CacheService) WarmUp(ctx context.Context) (int, error) {
+	if !s.cacheConfig.Enabled {
+		return 0, nil
+	}
+
+	var (
+		after  *entity.FeatureTag
+		warmed int
+	)
+
+	for {
+		banners, err := s.bannerRepo.GetActiveBanners(ctx, after, s.cacheConfig.WarmUpBatchSize)
+		if err != nil {
+			return warmed, err
+		}
+
+		if len(banners) == 0 {
+			return warmed, nil
+		}
+
+		items := make([]entity.CacheItem, 0, len(banners))
+		for i := range banners {
+			banner := &banners[i]
+
+			ttl, hardTTL := s.cacheConfig.ttls(&banner.Banner)
+			if hardTTL <= 0 {
+				continue
+			}
+
+			data, err := encodeCachedBanner(cachedBanner{Banner: &banner.Banner}, ttl)
+			if err != nil {
+				return warmed, fmt.Errorf("CacheService.WarmUp - encodeCachedBanner: %w", err)
+			}
+
+			items = append(items, entity.CacheItem{
+				Key:        bannerCacheKey(banner.TagID, banner.FeatureID),
+				Value:      data,
+				Expiration: hardTTL,
+			})
+		}
+
+		if err := s.cacheRepo.SetMany(ctx, items); err != nil {
+			return warmed, err
+		}
+		warmed += len(items)
+
+		if len(banners) < s.cacheConfig.WarmUpBatchSize {
+			return warmed, nil
+		}
+
+		last := banners[len(banners)-1]
+		after = &entity.FeatureTag{FeatureID: last.FeatureID, TagID: last.TagID}
+	}
+}
+
+// Run evicts the keys invalidated by any instance from the local cache until ctx is canceled.
+func (s *CacheService) Run(ctx context.Context) {
+	if s.localCache == nil {
+		return
+	}
+
+	err := s.invalidationRepo.Subscribe(ctx, func(keys []string) {
+		s.localCache.Evict(keys...)
+	})
+	if err != nil {
+		s.l.Err(err).Msg("CacheService.Run - s.invalidationRepo.Subscribe")
+	}
+}
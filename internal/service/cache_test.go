@@ -0,0 +1,185 @@
+package service_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+func TestCacheWarmUpCachesActiveBanners(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	l := zerolog.Nop()
+	s := service.NewCacheService(&l, repo, cache, &fakeInvalidation{}, nil, nil, service.BannerCacheConfig{
+		Enabled:         true,
+		TTL:             time.Minute,
+		WarmUpBatchSize: 2,
+	})
+
+	for id := 1; id <= 5; id++ {
+		repo.banners[id] = &fakeBanner{featureID: id, tagIDs: []int{7}, content: `{}`, maxVersion: 1}
+	}
+
+	warmed, err := s.WarmUp(ctx)
+	if err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+	if warmed != 5 {
+		t.Errorf("WarmUp = %d, want 5", warmed)
+	}
+
+	want := []string{"banner:7:1", "banner:7:2", "banner:7:3", "banner:7:4", "banner:7:5"}
+	if got := cache.keys(); !slices.Equal(got, want) {
+		t.Errorf("cache keys after warm-up = %v, want %v", got, want)
+	}
+
+	bannerService := newBannerService(repo, cache)
+	if _, err := bannerService.GetBanner(ctx, 7, 3, nil, "", false); err != nil {
+		t.Fatalf("GetBanner: %v", err)
+	}
+	if repo.calls() != 0 {
+		t.Errorf("repository calls after warm-up = %d, want 0", repo.calls())
+	}
+}
+
+func TestCacheWarmUpStopsOnEmptyBatch(t *testing.T) {
+	repo := newFakeBannerRepo()
+	l := zerolog.Nop()
+	s := service.NewCacheService(&l, repo, newFakeCache(), &fakeInvalidation{}, nil, nil, service.BannerCacheConfig{
+		Enabled: true,
+		TTL:     time.Minute,
+	})
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{7}, content: `{}`, maxVersion: 1}
+
+	warmed, err := s.WarmUp(context.Background())
+	if err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+	if warmed != 0 {
+		t.Errorf("WarmUp with zero batch size = %d, want 0", warmed)
+	}
+}
+
+func TestCacheFlushByFeature(t *testing.T) {
+	ctx := context.Background()
+	cache := newFakeCache()
+	invalidation := &fakeInvalidation{}
+	l := zerolog.Nop()
+	s := service.NewCacheService(&l, newFakeBannerRepo(), cache, invalidation, nil, nil, service.BannerCacheConfig{})
+
+	for _, key := range []string{"banner:1:2", "banner:1:2:v1", "banner:3:2:v4", "banner:1:12", "banner:2:1"} {
+		_ = cache.Set(ctx, key, "cached", time.Minute)
+	}
+
+	deleted, err := s.Flush(ctx, intPtr(2), nil)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Flush = %d, want 3", deleted)
+	}
+
+	want := []string{"banner:1:12", "banner:2:1"}
+	if got := cache.keys(); !slices.Equal(got, want) {
+		t.Errorf("cache keys after flush = %v, want %v", got, want)
+	}
+	if len(invalidation.published) != 3 {
+		t.Errorf("published keys = %v, want 3 keys", invalidation.published)
+	}
+}
+
+func TestCacheStatsCountsLookups(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	l := zerolog.Nop()
+	s := service.NewCacheService(&l, repo, cache, &fakeInvalidation{}, nil, nil, service.BannerCacheConfig{})
+	bannerService := newBannerService(repo, cache)
+
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1}
+
+	before, err := s.Stats(ctx, false)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+
+	for _, useLastRevision := range []bool{false, false, true} {
+		if _, err := bannerService.GetBanner(ctx, 1, 1, nil, "", useLastRevision); err != nil {
+			t.Fatalf("GetBanner: %v", err)
+		}
+	}
+
+	after, err := s.Stats(ctx, true)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+
+	if hits := after.Hits - before.Hits; hits != 1 {
+		t.Errorf("hits = %d, want 1", hits)
+	}
+	if misses := after.Misses - before.Misses; misses != 1 {
+		t.Errorf("misses = %d, want 1", misses)
+	}
+	if bypasses := after.Bypasses - before.Bypasses; bypasses != 1 {
+		t.Errorf("bypasses = %d, want 1", bypasses)
+	}
+	if before.Keys != nil {
+		t.Errorf("keys counted without being requested: %d", *before.Keys)
+	}
+	if after.Keys == nil || *after.Keys != 1 {
+		t.Errorf("keys = %v, want 1", after.Keys)
+	}
+}
+
+type fakeCachePolicy struct {
+	ttls map[int]time.Duration
+}
+
+func (p *fakeCachePolicy) GetFeatureTTLs(context.Context) ([]entity.FeatureCacheTTL, error) {
+	return nil, nil
+}
+
+func (p *fakeCachePolicy) SetFeatureTTL(_ context.Context, featureID int, ttl time.Duration) error {
+	p.ttls[featureID] = ttl
+	return nil
+}
+
+func (p *fakeCachePolicy) DeleteFeatureTTL(_ context.Context, featureID int) error {
+	delete(p.ttls, featureID)
+	return nil
+}
+
+func TestCacheSetFeatureTTLEvictsFeature(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	invalidation := &fakeInvalidation{}
+	l := zerolog.Nop()
+	s := service.NewCacheService(&l, repo, cache, invalidation, nil, &fakeCachePolicy{ttls: map[int]time.Duration{}},
+		service.BannerCacheConfig{})
+
+	for _, key := range []string{"banner:1:2", "banner:3:2:v4", "banner:1:3"} {
+		_ = cache.Set(ctx, key, "cached", time.Minute)
+	}
+
+	if err := s.SetFeatureTTL(ctx, 2, time.Second); err != nil {
+		t.Fatalf("SetFeatureTTL: %v", err)
+	}
+
+	if got, want := cache.keys(), []string{"banner:1:3"}; !slices.Equal(got, want) {
+		t.Errorf("cache keys after SetFeatureTTL = %v, want %v", got, want)
+	}
+	if len(invalidation.published) != 2 {
+		t.Errorf("published keys = %v, want 2 keys", invalidation.published)
+	}
+	if repo.calls() != 0 {
+		t.Errorf("repository calls = %d, want 0", repo.calls())
+	}
+}
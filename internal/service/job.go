@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/rs/zerolog"
+)
+
+// _staleJobTimeout is how long a running job may go without progress before another worker takes it over.
+const _staleJobTimeout = 5 * time.Minute
+
+type JobService struct {
+	bannerRepo     repository.Banner
+	jobRepo        repository.Job
+	cache          *cacheInvalidator
+	pollInterval   time.Duration
+	batchSize      int
+	trashRetention time.Duration
+	purgeInterval  time.Duration
+	l              *zerolog.Logger
+}
+
+func NewJobService(
+	l *zerolog.Logger, bannerRepo repository.Banner, jobRepo repository.Job, cacheRepo repository.Cache,
+	invalidationRepo repository.Invalidation, pollInterval time.Duration, batchSize int,
+	trashRetention, purgeInterval time.Duration,
+) *JobService {
+	return &JobService{
+		bannerRepo:     bannerRepo,
+		jobRepo:        jobRepo,
+		cache:          newCacheInvalidator(l, bannerRepo, cacheRepo, invalidationRepo),
+		pollInterval:   pollInterval,
+		batchSize:      batchSize,
+		trashRetention: trashRetention,
+		purgeInterval:  purgeInterval,
+		l:              l,
+	}
+}
+
+func (s *JobService) GetJob(ctx context.Context, jobID int) (*entity.Job, error) {
+	return s.jobRepo.GetJob(ctx, jobID)
+}
+
+// Run processes queued jobs and purges expired banners from the trash until ctx is canceled.
+func (s *JobService) Run(ctx context.Context) {
+	jobTicker := time.NewTicker(s.pollInterval)
+	defer jobTicker.Stop()
+
+	purgeTicker := time.NewTicker(s.purgeInterval)
+	defer purgeTicker.Stop()
+
+	s.processJobs(ctx)
+	s.purgeTrash(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-jobTicker.C:
+			s.processJobs(ctx)
+		case <-purgeTicker.C:
+			s.purgeTrash(ctx)
+		}
+	}
+}
+
+func (s *JobService) purgeTrash(ctx context.Context) {
+	for ctx.Err() == nil {
+		purged, err := s.bannerRepo.PurgeDeletedBanners(ctx, s.trashRetention, s.batchSize)
+		if err != nil {
+			s.l.Err(err).Msg("JobService.purgeTrash - s.bannerRepo.PurgeDeletedBanners")
+			return
+		}
+
+		if purged == 0 {
+			return
+		}
+
+		s.l.Info().Int("purged", purged).Msg("JobService.purgeTrash - purged deleted banners")
+	}
+}
+
+func (s *JobService) processJobs(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := s.jobRepo.AcquireJob(ctx, _staleJobTimeout)
+		if err != nil {
+			if !errors.Is(err, postgresrepo.ErrJobNotFound) {
+				s.l.Err(err).Msg("JobService.processJobs - s.jobRepo.AcquireJob")
+			}
+			return
+		}
+
+		jobErr := s.processJob(ctx, job)
+		if jobErr != nil {
+			s.l.Err(jobErr).Int("job_id", job.ID).Msg("JobService.processJobs - s.processJob")
+		}
+
+		// A canceled job is left running and will be resumed as stale on the next start.
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := s.jobRepo.FinishJob(ctx, job.ID, jobErr); err != nil {
+			s.l.Err(err).Int("job_id", job.ID).Msg("JobService.processJobs - s.jobRepo.FinishJob")
+		}
+	}
+}
+
+func (s *JobService) processJob(ctx context.Context, job *entity.Job) error {
+	var featureID, tagID *int
+
+	switch job.Kind {
+	case entity.JobKindDeleteByFeature:
+		featureID = &job.TargetID
+	case entity.JobKindDeleteByTag:
+		tagID = &job.TargetID
+	default:
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	var deletedBy string
+	if job.CreatedBy != nil {
+		deletedBy = *job.CreatedBy
+	}
+
+	remaining, err := s.bannerRepo.CountBanners(ctx, featureID, tagID)
+	if err != nil {
+		return err
+	}
+
+	// A resumed job keeps the progress it had already made.
+	total := job.Processed + remaining
+	processed := job.Processed
+
+	if err := s.jobRepo.UpdateJobProgress(ctx, job.ID, total, processed); err != nil {
+		return err
+	}
+
+	for {
+		bannerIDs, err := s.bannerRepo.SoftDeleteBannersBatch(ctx, featureID, tagID, deletedBy, s.batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(bannerIDs) == 0 {
+			return nil
+		}
+
+		s.cache.invalidateBanners(ctx, bannerIDs...)
+
+		processed += len(bannerIDs)
+		total = max(total, processed)
+
+		if err := s.jobRepo.UpdateJobProgress(ctx, job.ID, total, processed); err != nil {
+			return err
+		}
+	}
+}
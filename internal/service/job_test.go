@@ -0,0 +1,251 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	postgresrepo "github.com/realPointer/banners/internal/repository/postgres"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/rs/zerolog"
+)
+
+// matches reports whether b is linked to the feature or tag a bulk delete targets.
+func (b *fakeBanner) matches(featureID, tagID *int) bool {
+	if featureID != nil && b.featureID != *featureID {
+		return false
+	}
+	return tagID == nil || slices.Contains(b.tagIDs, *tagID)
+}
+
+func (r *fakeBannerRepo) CountBanners(_ context.Context, featureID, tagID *int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, b := range r.banners {
+		if !b.deleted && b.matches(featureID, tagID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeBannerRepo) SoftDeleteBannersBatch(
+	_ context.Context, featureID, tagID *int, _ string, batchSize int,
+) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.deleteErr != nil {
+		return nil, r.deleteErr
+	}
+
+	var ids []int
+	for id, b := range r.banners {
+		if !b.deleted && b.matches(featureID, tagID) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	ids = ids[:min(batchSize, len(ids))]
+
+	for _, id := range ids {
+		r.banners[id].deleted = true
+	}
+	return ids, nil
+}
+
+// PurgeDeletedBanners returns the next of the configured purge counts, and zero once they run out.
+func (r *fakeBannerRepo) PurgeDeletedBanners(context.Context, time.Duration, int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.purgeCalls++
+	if len(r.purges) == 0 {
+		return 0, nil
+	}
+	purged := r.purges[0]
+	r.purges = r.purges[1:]
+	return purged, nil
+}
+
+type jobProgress struct {
+	total, processed int
+}
+
+// fakeJobRepo hands out its queued jobs and records what the service reports about them.
+type fakeJobRepo struct {
+	repository.Job
+
+	mu       sync.Mutex
+	queue    []*entity.Job
+	progress map[int][]jobProgress
+	finished map[int]error
+}
+
+func newFakeJobRepo(jobs ...*entity.Job) *fakeJobRepo {
+	return &fakeJobRepo{queue: jobs, progress: make(map[int][]jobProgress), finished: make(map[int]error)}
+}
+
+func (r *fakeJobRepo) AcquireJob(context.Context, time.Duration) (*entity.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.queue) == 0 {
+		return nil, postgresrepo.ErrJobNotFound
+	}
+	job := r.queue[0]
+	r.queue = r.queue[1:]
+	return job, nil
+}
+
+func (r *fakeJobRepo) UpdateJobProgress(_ context.Context, jobID, total, processed int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress[jobID] = append(r.progress[jobID], jobProgress{total: total, processed: processed})
+	return nil
+}
+
+func (r *fakeJobRepo) FinishJob(_ context.Context, jobID int, jobErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished[jobID] = jobErr
+	return nil
+}
+
+func (r *fakeJobRepo) finishedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.finished)
+}
+
+// runJobs runs the job service until done reports true and returns once Run has stopped.
+func runJobs(t *testing.T, s *service.JobService, done func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	if !done() {
+		t.Fatal("job service did not finish in time")
+	}
+}
+
+func newJobService(repo *fakeBannerRepo, jobs *fakeJobRepo, cache *fakeCache) *service.JobService {
+	l := zerolog.Nop()
+	return service.NewJobService(&l, repo, jobs, cache, &fakeInvalidation{}, time.Hour, 2, time.Hour, time.Hour)
+}
+
+func TestJobServiceDeletesInBatches(t *testing.T) {
+	repo := newFakeBannerRepo()
+	cache := newFakeCache()
+	for id := 1; id <= 5; id++ {
+		repo.banners[id] = &fakeBanner{featureID: 1, tagIDs: []int{id}, content: `{}`, maxVersion: 1}
+		_ = cache.Set(context.Background(), fmt.Sprintf("banner:%d:1", id), "cached", time.Minute)
+	}
+	repo.banners[6] = &fakeBanner{featureID: 2, tagIDs: []int{1}, content: `{}`, maxVersion: 1}
+	_ = cache.Set(context.Background(), "banner:1:2", "cached", time.Minute)
+
+	createdBy := "admin"
+	jobs := newFakeJobRepo(&entity.Job{ID: 1, Kind: entity.JobKindDeleteByFeature, TargetID: 1, CreatedBy: &createdBy})
+
+	runJobs(t, newJobService(repo, jobs, cache), func() bool { return jobs.finishedCount() == 1 })
+
+	if err := jobs.finished[1]; err != nil {
+		t.Errorf("job finished with error %v, want none", err)
+	}
+
+	want := []jobProgress{{5, 0}, {5, 2}, {5, 4}, {5, 5}}
+	if got := jobs.progress[1]; !slices.Equal(got, want) {
+		t.Errorf("job progress = %v, want %v", got, want)
+	}
+
+	for id, b := range repo.banners {
+		if b.deleted != (b.featureID == 1) {
+			t.Errorf("banner %d deleted = %t, want %t", id, b.deleted, b.featureID == 1)
+		}
+	}
+
+	if got := cache.keys(); !slices.Equal(got, []string{"banner:1:2"}) {
+		t.Errorf("cache keys after job = %v, want [banner:1:2]", got)
+	}
+}
+
+func TestJobServiceResumesProgress(t *testing.T) {
+	repo := newFakeBannerRepo()
+	for id := 1; id <= 3; id++ {
+		repo.banners[id] = &fakeBanner{featureID: id, tagIDs: []int{7}, content: `{}`, maxVersion: 1}
+	}
+
+	jobs := newFakeJobRepo(&entity.Job{
+		ID: 1, Kind: entity.JobKindDeleteByTag, TargetID: 7, Status: entity.JobStatusRunning, Total: 10, Processed: 7,
+	})
+
+	runJobs(t, newJobService(repo, jobs, newFakeCache()), func() bool { return jobs.finishedCount() == 1 })
+
+	want := []jobProgress{{10, 7}, {10, 9}, {10, 10}}
+	if got := jobs.progress[1]; !slices.Equal(got, want) {
+		t.Errorf("job progress = %v, want %v", got, want)
+	}
+}
+
+func TestJobServiceFailsJobs(t *testing.T) {
+	repo := newFakeBannerRepo()
+	repo.banners[1] = &fakeBanner{featureID: 1, tagIDs: []int{1}, content: `{}`, maxVersion: 1}
+	repo.deleteErr = errors.New("delete failed")
+
+	jobs := newFakeJobRepo(
+		&entity.Job{ID: 1, Kind: entity.JobKindDeleteByFeature, TargetID: 1},
+		&entity.Job{ID: 2, Kind: "unknown", TargetID: 1},
+	)
+
+	runJobs(t, newJobService(repo, jobs, newFakeCache()), func() bool { return jobs.finishedCount() == 2 })
+
+	if err := jobs.finished[1]; !errors.Is(err, repo.deleteErr) {
+		t.Errorf("failed delete finished with error %v, want %v", err, repo.deleteErr)
+	}
+	if jobs.finished[2] == nil {
+		t.Error("job of unknown kind finished without error")
+	}
+	if repo.banners[1].deleted {
+		t.Error("banner deleted by a failed job")
+	}
+}
+
+func TestJobServicePurgesTrashUntilEmpty(t *testing.T) {
+	repo := newFakeBannerRepo()
+	repo.purges = []int{2, 1, 0, 5}
+	jobs := newFakeJobRepo()
+
+	calls := func() int {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return repo.purgeCalls
+	}
+
+	runJobs(t, newJobService(repo, jobs, newFakeCache()), func() bool { return calls() >= 3 })
+
+	// The purge stops at the first empty batch and waits for the next tick.
+	if got := calls(); got != 3 {
+		t.Errorf("purge calls = %d, want 3", got)
+	}
+}
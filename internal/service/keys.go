@@ -0,0 +1,254 @@
+package service
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/realPointer/banners/internal/entity"
+)
+
+// _keyReloadInterval is how often every instance reloads the signing keys.
+const _keyReloadInterval = time.Minute
+
+// _keySigningDelay is how old a new key must be before it signs. Every instance loads it within
+// _keyReloadInterval, and JWKS consumers refetch it within the max-age of the key set, which is
+// kept below _keyReloadInterval.
+const _keySigningDelay = 2 * _keyReloadInterval
+
+// _rsaKeyBits is the size of generated RS256 keys.
+const _rsaKeyBits = 2048
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// _signingMethods are the algorithms tokens may be signed with. Verification pins the algorithm
+// of the key named by the token, so a token cannot pick a weaker one in its header.
+var _signingMethods = map[string]jwt.SigningMethod{
+	jwt.SigningMethodRS256.Alg(): jwt.SigningMethodRS256,
+	jwt.SigningMethodEdDSA.Alg(): jwt.SigningMethodEdDSA,
+}
+
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// keyRing holds the signing keys loaded from the database, newest first.
+type keyRing struct {
+	mu   sync.RWMutex
+	keys []*signingKey
+}
+
+func (k *keyRing) set(keys []*signingKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = keys
+}
+
+// signing returns the newest key that is old enough to be known everywhere. Right after the first
+// start there is no such key, and the newest one is used anyway.
+func (k *keyRing) signing(now time.Time) (*signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if now.Sub(key.createdAt) >= _keySigningDelay && now.Before(key.expiresAt) {
+			return key, true
+		}
+	}
+
+	if len(k.keys) > 0 && now.Before(k.keys[0].expiresAt) {
+		return k.keys[0], true
+	}
+
+	return nil, false
+}
+
+func (k *keyRing) lookup(id string, now time.Time) (*signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.id == id && now.Before(key.expiresAt) {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (k *keyRing) jwks(now time.Time) entity.JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := entity.JWKS{Keys: []entity.JWK{}}
+	for _, key := range k.keys {
+		if now.Before(key.expiresAt) {
+			jwks.Keys = append(jwks.Keys, key.jwk())
+		}
+	}
+
+	return jwks
+}
+
+func (k *signingKey) jwk() entity.JWK {
+	jwk := entity.JWK{
+		Kid: k.id,
+		Use: "sig",
+		Alg: k.method.Alg(),
+	}
+
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
+
+// generateSigningKey creates a key for algorithm with its private part sealed by secret.
+func generateSigningKey(algorithm, secret string, now time.Time, lifetime time.Duration) (*entity.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, _rsaKeyBits)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("generateSigningKey - %q: %w", algorithm, ErrUnsupportedAlgorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generateSigningKey - generate: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("generateSigningKey - x509.MarshalPKCS8PrivateKey: %w", err)
+	}
+
+	sealed, err := sealKey(secret, der)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.SigningKey{
+		ID:         id,
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(lifetime),
+	}, nil
+}
+
+// openSigningKey decrypts a stored key with secret.
+func openSigningKey(key *entity.SigningKey, secret string) (*signingKey, error) {
+	method, ok := _signingMethods[key.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("openSigningKey - %q: %w", key.Algorithm, ErrUnsupportedAlgorithm)
+	}
+
+	der, err := openKey(secret, key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("openSigningKey - x509.ParsePKCS8PrivateKey: %w", err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("openSigningKey - unexpected key type %T", parsed)
+	}
+
+	return &signingKey{
+		id:        key.ID,
+		method:    method,
+		private:   private,
+		createdAt: key.CreatedAt,
+		expiresAt: key.ExpiresAt,
+	}, nil
+}
+
+// sealKey encrypts a private key with AES-GCM under a key derived from secret, so the keys
+// stored in the database are useless without the service configuration.
+func sealKey(secret string, plaintext []byte) ([]byte, error) {
+	gcm, err := newKeyCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("sealKey - rand.Read: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openKey(secret string, sealed []byte) ([]byte, error) {
+	gcm, err := newKeyCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("openKey - sealed key too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("openKey - gcm.Open: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func newKeyCipher(secret string) (cipher.AEAD, error) {
+	sum := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("newKeyCipher - aes.NewCipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("newKeyCipher - cipher.NewGCM: %w", err)
+	}
+
+	return gcm, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	_cacheResultHit    = "hit"
+	_cacheResultMiss   = "miss"
+	_cacheResultError  = "error"
+	_cacheResultBypass = "bypass"
+)
+
+var _cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "banners",
+	Subsystem: "cache",
+	Name:      "requests_total",
+	Help:      "User banner cache lookups by result: hit, miss, error or bypass.",
+}, []string{"result"})
+
+// cacheCounters mirrors the cache lookup counters exported to Prometheus,
+// so the admin API can report them without querying Prometheus.
+type cacheCounters struct {
+	hits     atomic.Int64
+	misses   atomic.Int64
+	errors   atomic.Int64
+	bypasses atomic.Int64
+}
+
+var _cacheCounters cacheCounters
+
+func (c *cacheCounters) hit() {
+	c.hits.Add(1)
+	_cacheRequests.WithLabelValues(_cacheResultHit).Inc()
+}
+
+func (c *cacheCounters) miss() {
+	c.misses.Add(1)
+	_cacheRequests.WithLabelValues(_cacheResultMiss).Inc()
+}
+
+func (c *cacheCounters) error() {
+	c.errors.Add(1)
+	_cacheRequests.WithLabelValues(_cacheResultError).Inc()
+}
+
+func (c *cacheCounters) bypass() {
+	c.bypasses.Add(1)
+	_cacheRequests.WithLabelValues(_cacheResultBypass).Inc()
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/pkg/jwks"
+)
+
+// _oidcParser accepts the asymmetric algorithms identity providers sign ID and access tokens with.
+var _oidcParser = &jwt.Parser{ValidMethods: []string{
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(), jwt.SigningMethodPS384.Alg(), jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}}
+
+// TokenVerifier verifies access tokens issued by someone other than this service.
+type TokenVerifier interface {
+	Verify(ctx context.Context, tokenString string) (*TokenClaims, error)
+}
+
+// KeySet looks up the public keys of a token issuer.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (jwks.Key, error)
+}
+
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+	// UsernameClaim names the claim used as the username. The subject is used when it is missing.
+	UsernameClaim string
+	// RoleClaim is the claim holding the roles or groups of the user, a string or a list of strings.
+	// Nested claims are separated by dots, such as realm_access.roles.
+	RoleClaim string
+	// AdminValues are the RoleClaim values that grant the admin role. Everyone else gets the user role.
+	AdminValues []string
+}
+
+// OIDCVerifier verifies JWTs issued by an OpenID Connect identity provider.
+type OIDCVerifier struct {
+	keys   KeySet
+	config OIDCConfig
+}
+
+func NewOIDCVerifier(keys KeySet, config OIDCConfig) *OIDCVerifier {
+	return &OIDCVerifier{
+		keys:   keys,
+		config: config,
+	}
+}
+
+func (v *OIDCVerifier) Verify(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	ctx, span := _tracer.Start(ctx, "OIDCVerifier.Verify")
+	defer span.End()
+
+	claims := jwt.MapClaims{}
+
+	_, err := _oidcParser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := v.keys.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OIDCVerifier.Verify - parse: %w", err)
+	}
+
+	if !claims.VerifyIssuer(v.config.Issuer, true) ||
+		!claims.VerifyAudience(v.config.Audience, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrInvalidToken
+	}
+
+	username, _ := claims[v.config.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+	if username == "" {
+		return nil, ErrInvalidToken
+	}
+
+	role := entity.RoleUser
+	for _, value := range claimValues(claims, v.config.RoleClaim) {
+		if slices.Contains(v.config.AdminValues, value) {
+			role = entity.RoleAdmin
+			break
+		}
+	}
+
+	exp, _ := claims["exp"].(float64)
+	jti, _ := claims["jti"].(string)
+
+	return &TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Issuer:    v.config.Issuer,
+			Subject:   username,
+			ExpiresAt: int64(exp),
+		},
+		Username: username,
+		Role:     role,
+	}, nil
+}
+
+// claimValues returns the strings found at the dotted path in claims.
+func claimValues(claims jwt.MapClaims, path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package service_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/realPointer/banners/internal/entity"
+	"github.com/realPointer/banners/internal/repository"
+	"github.com/realPointer/banners/internal/service"
+	"github.com/realPointer/banners/pkg/jwks"
+	"github.com/rs/zerolog"
+)
+
+const _testIssuer = "https://idp.example.com/realms/company"
+
+// testIdP signs tokens with a key published in a JWKS file.
+type testIdP struct {
+	key  *rsa.PrivateKey
+	jwks string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+
+	set := entity.JWKS{Keys: []entity.JWK{{
+		Kty: "RSA",
+		Kid: "idp-key",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	return &testIdP{key: key, jwks: path}
+}
+
+func (p *testIdP) token(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "idp-key"
+
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func (p *testIdP) verifier() *service.OIDCVerifier {
+	return service.NewOIDCVerifier(jwks.New(p.jwks), service.OIDCConfig{
+		Issuer:        _testIssuer,
+		Audience:      "banners",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "realm_access.roles",
+		AdminValues:   []string{"banners-admins"},
+	})
+}
+
+func idpClaims(roles ...interface{}) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                _testIssuer,
+		"aud":                []interface{}{"banners", "account"},
+		"sub":                "8d1f0c2e",
+		"preferred_username": "bob",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"realm_access":       map[string]interface{}{"roles": roles},
+	}
+}
+
+func TestOIDCVerifierMapsRoles(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.verifier()
+
+	tests := []struct {
+		name  string
+		roles []interface{}
+		want  string
+	}{
+		{name: "admin", roles: []interface{}{"offline_access", "banners-admins"}, want: entity.RoleAdmin},
+		{name: "user", roles: []interface{}{"offline_access"}, want: entity.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), idp.token(t, idpClaims(tt.roles...)))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.Username != "bob" || claims.Role != tt.want {
+				t.Errorf("claims = %s/%s, want bob/%s", claims.Username, claims.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierRejectsInvalidClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.verifier()
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{name: "issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-service" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idpClaims()
+			tt.modify(claims)
+
+			if _, err := v.Verify(context.Background(), idp.token(t, claims)); err == nil {
+				t.Error("Verify accepted the token")
+			}
+		})
+	}
+}
+
+func TestParseTokenFallsBackToExternalVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp := newTestIdP(t)
+
+	tokens := service.TokenConfig{SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute}
+	users := newFakeUserRepo()
+	s := newAuthServiceWithConfig(users, newFakeRefreshTokenRepo(), &fakeRevocation{}, &fakeSigningKeyRepo{}, tokens,
+		service.RegistrationConfig{Open: true}, idp.verifier())
+	if err := s.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	claims, err := s.ParseToken(ctx, idp.token(t, idpClaims("banners-admins")))
+	if err != nil {
+		t.Fatalf("ParseToken of external token: %v", err)
+	}
+	if claims.Role != entity.RoleAdmin {
+		t.Errorf("external token role = %s, want %s", claims.Role, entity.RoleAdmin)
+	}
+
+	if err := s.Register(ctx, "alice", "secret"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	local, err := s.Login(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := s.ParseToken(ctx, local.AccessToken); err != nil {
+		t.Errorf("ParseToken of local token: %v", err)
+	}
+}
+
+func TestNewServicesPassesTokenVerifiers(t *testing.T) {
+	ctx := context.Background()
+	idp := newTestIdP(t)
+
+	l := zerolog.Nop()
+	services := service.NewServices(&l, service.ServicesDependencies{
+		Repositories: &repository.Repositories{
+			User:         newFakeUserRepo(),
+			RefreshToken: newFakeRefreshTokenRepo(),
+			Revocation:   &fakeRevocation{},
+			SigningKey:   &fakeSigningKeyRepo{},
+		},
+		Tokens:         service.TokenConfig{SignKey: "key", Algorithm: "EdDSA", KeyRotation: time.Hour, AccessTTL: time.Minute},
+		TokenVerifiers: []service.TokenVerifier{idp.verifier()},
+	})
+	if err := services.Auth.RotateKeys(ctx); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+
+	claims, err := services.Auth.ParseToken(ctx, idp.token(t, idpClaims("banners-admins")))
+	if err != nil {
+		t.Fatalf("ParseToken of external token: %v", err)
+	}
+	if claims.Username != "bob" || claims.Role != entity.RoleAdmin {
+		t.Errorf("claims = %s/%s, want bob/%s", claims.Username, claims.Role, entity.RoleAdmin)
+	}
+}
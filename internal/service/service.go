@@ -12,36 +12,96 @@ import (
 //go:generate mockgen -source=service.go -destination=mocks/mock.go
 
 type Banner interface {
-	GetBanner(ctx context.Context, tagID, featureID int, useLastRevision bool) (string, error)
+	GetBanner(ctx context.Context, tagID, featureID int, version *int, subjectKey string, useLastRevision bool) (string, error)
 	GetBanners(ctx context.Context, filter *entity.BannerFilter) ([]entity.BannerInfo, error)
 	CreateBanner(ctx context.Context, banner *entity.BannerCreate) (int, error)
 	UpdateBanner(ctx context.Context, bannerID int, update *entity.BannerUpdate) error
-	DeleteBanner(ctx context.Context, bannerID int) error
-	DeleteBannersByFeatureID(ctx context.Context, featureID int) error
-	DeleteBannersByTagID(ctx context.Context, tagID int) error
+	DeleteBanner(ctx context.Context, bannerID int, deletedBy string, hard bool) error
+	DeleteBannersByFeatureID(ctx context.Context, featureID int, deletedBy string) (int, error)
+	DeleteBannersByTagID(ctx context.Context, tagID int, deletedBy string) (int, error)
+	GetBannerVersions(ctx context.Context, bannerID int) ([]entity.BannerVersion, error)
+	GetBannerVersion(ctx context.Context, bannerID, version int) (*entity.BannerVersion, error)
+	RollbackBanner(ctx context.Context, bannerID, version int) error
+	PinBannerVersion(ctx context.Context, bannerID, version int) error
+	UnpinBannerVersion(ctx context.Context, bannerID int) error
+	RestoreBanner(ctx context.Context, bannerID int) error
 }
 
 type Auth interface {
-	Register(ctx context.Context, username, password, role string) error
-	Login(ctx context.Context, username, password string) (string, error)
-	ParseToken(tokenString string) (*TokenClaims, error)
+	Register(ctx context.Context, username, password string) error
+	CreateUser(ctx context.Context, username, password, role string) error
+	Bootstrap(ctx context.Context, token, username, password string) error
+	Login(ctx context.Context, username, password string) (*entity.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*entity.TokenPair, error)
+	Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error
+	ParseToken(ctx context.Context, tokenString string) (*TokenClaims, error)
+	JWKS() entity.JWKS
+	RotateKeys(ctx context.Context) error
+	Run(ctx context.Context)
+}
+
+type APIKey interface {
+	CreateAPIKey(ctx context.Context, name, role string, expiresAt *time.Time, createdBy string) (*entity.CreatedAPIKey, error)
+	GetAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	Authenticate(ctx context.Context, key string) (*TokenClaims, error)
+}
+
+type Job interface {
+	GetJob(ctx context.Context, jobID int) (*entity.Job, error)
+	Run(ctx context.Context)
+}
+
+type Cache interface {
+	Stats(ctx context.Context, countKeys bool) (*entity.CacheStats, error)
+	Flush(ctx context.Context, featureID, tagID *int) (int, error)
+	GetFeatureTTLs(ctx context.Context) ([]entity.FeatureCacheTTL, error)
+	SetFeatureTTL(ctx context.Context, featureID int, ttl time.Duration) error
+	DeleteFeatureTTL(ctx context.Context, featureID int) error
+	WarmUp(ctx context.Context) (int, error)
+	Run(ctx context.Context)
 }
 
 type Services struct {
 	Banner
 	Auth
+	APIKey
+	Job
+	Cache
 }
 
 type ServicesDependencies struct {
 	Repositories *repository.Repositories
-	SignKey      string
-	TokenTTL     time.Duration
+	Tokens       TokenConfig
 	Salt         string
+	Registration RegistrationConfig
+	// TokenVerifiers accept access tokens issued by external identity providers.
+	TokenVerifiers  []TokenVerifier
+	JobPollInterval time.Duration
+	JobBatchSize    int
+	TrashRetention  time.Duration
+	TrashPurgeEvery time.Duration
+	BannerCache     BannerCacheConfig
 }
 
 func NewServices(l *zerolog.Logger, deps ServicesDependencies) *Services {
 	return &Services{
-		Banner: NewBannerService(l, deps.Repositories.Banner, deps.Repositories.Cache),
-		Auth:   NewAuthService(l, deps.Repositories.User, deps.SignKey, deps.TokenTTL, deps.Salt),
+		Banner: NewBannerService(
+			l, deps.Repositories.Banner, deps.Repositories.Cache, deps.Repositories.Invalidation,
+			deps.Repositories.Job, deps.BannerCache,
+		),
+		Auth: NewAuthService(
+			l, deps.Repositories.User, deps.Repositories.RefreshToken, deps.Repositories.Revocation,
+			deps.Repositories.SigningKey, deps.Tokens, deps.Salt, deps.Registration, deps.TokenVerifiers...,
+		),
+		APIKey: NewAPIKeyService(l, deps.Repositories.APIKey),
+		Job: NewJobService(
+			l, deps.Repositories.Banner, deps.Repositories.Job, deps.Repositories.Cache, deps.Repositories.Invalidation,
+			deps.JobPollInterval, deps.JobBatchSize, deps.TrashRetention, deps.TrashPurgeEvery,
+		),
+		Cache: NewCacheService(
+			l, deps.Repositories.Banner, deps.Repositories.Cache, deps.Repositories.Invalidation,
+			deps.Repositories.LocalCache, deps.Repositories.CachePolicy, deps.BannerCache,
+		),
 	}
 }
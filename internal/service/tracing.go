@@ -0,0 +1,7 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+var _tracer = otel.Tracer("github.com/realPointer/banners/internal/service")
@@ -0,0 +1 @@
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS pinned_version INTEGER;
@@ -0,0 +1,3 @@
+ALTER TABLE banners DROP COLUMN IF EXISTS active_until;
+
+ALTER TABLE banners DROP COLUMN IF EXISTS active_from;
@@ -0,0 +1,3 @@
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ;
+
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS active_until TIMESTAMPTZ;
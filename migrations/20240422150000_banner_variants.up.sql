@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS banner_variants (
+    banner_id INTEGER NOT NULL REFERENCES banners (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    content JSONB NOT NULL,
+    PRIMARY KEY (banner_id, name)
+);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_banners_deleted_at;
+
+DROP INDEX IF EXISTS unq_feature_tag;
+
+DELETE FROM banners WHERE deleted;
+
+ALTER TABLE feature_tag_banners ADD CONSTRAINT unq_feature_tag UNIQUE (feature_id, tag_id);
+
+ALTER TABLE feature_tag_banners DROP COLUMN IF EXISTS deleted;
+
+ALTER TABLE banners DROP COLUMN IF EXISTS deleted_at;
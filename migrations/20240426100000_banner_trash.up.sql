@@ -0,0 +1,14 @@
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+UPDATE banners SET deleted_at = updated_at WHERE deleted AND deleted_at IS NULL;
+
+ALTER TABLE feature_tag_banners ADD COLUMN IF NOT EXISTS deleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE feature_tag_banners ftb SET deleted = b.deleted FROM banners b WHERE b.id = ftb.banner_id;
+
+-- A feature/tag pair only has to be unique among banners that are not in the trash.
+ALTER TABLE feature_tag_banners DROP CONSTRAINT IF EXISTS unq_feature_tag;
+
+CREATE UNIQUE INDEX unq_feature_tag ON feature_tag_banners (feature_id, tag_id) WHERE NOT deleted;
+
+CREATE INDEX idx_banners_deleted_at ON banners (deleted_at) WHERE deleted;
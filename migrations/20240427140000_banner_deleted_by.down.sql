@@ -0,0 +1,3 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS created_by;
+
+ALTER TABLE banners DROP COLUMN IF EXISTS deleted_by;
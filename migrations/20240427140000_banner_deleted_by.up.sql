@@ -0,0 +1,3 @@
+ALTER TABLE banners ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS created_by VARCHAR(255);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS feature_cache_ttls (
+    feature_id INTEGER PRIMARY KEY,
+    ttl_seconds INTEGER NOT NULL CHECK (ttl_seconds >= 0),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
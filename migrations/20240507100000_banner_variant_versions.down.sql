@@ -0,0 +1,9 @@
+DELETE FROM banner_variants v USING banners b WHERE b.id = v.banner_id AND v.version <> b.last_version;
+
+ALTER TABLE banner_variants DROP CONSTRAINT IF EXISTS fk_banner_variants_version;
+
+ALTER TABLE banner_variants DROP CONSTRAINT IF EXISTS banner_variants_pkey;
+
+ALTER TABLE banner_variants DROP COLUMN IF EXISTS version;
+
+ALTER TABLE banner_variants ADD PRIMARY KEY (banner_id, name);
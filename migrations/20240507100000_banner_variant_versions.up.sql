@@ -0,0 +1,19 @@
+ALTER TABLE banner_variants ADD COLUMN IF NOT EXISTS version INTEGER;
+
+ALTER TABLE banner_variants DROP CONSTRAINT IF EXISTS banner_variants_pkey;
+
+-- Variants used to apply to every version of a banner, so existing versions keep serving them.
+INSERT INTO banner_variants (banner_id, version, name, weight, content)
+SELECT v.banner_id, bv.version, v.name, v.weight, v.content
+FROM banner_variants v
+JOIN banner_versions bv ON bv.banner_id = v.banner_id
+WHERE v.version IS NULL;
+
+DELETE FROM banner_variants WHERE version IS NULL;
+
+ALTER TABLE banner_variants ALTER COLUMN version SET NOT NULL;
+
+ALTER TABLE banner_variants ADD PRIMARY KEY (banner_id, version, name);
+
+ALTER TABLE banner_variants ADD CONSTRAINT fk_banner_variants_version
+    FOREIGN KEY (banner_id, version) REFERENCES banner_versions (banner_id, version) ON DELETE CASCADE;
@@ -0,0 +1,157 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	_defaultMaxFailures = 5
+	_defaultCooldown    = 10 * time.Second
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker stops calling a failing dependency after maxFailures consecutive errors. Once cooldown
+// has passed it lets a single trial call through and closes again if that call succeeds.
+type Breaker struct {
+	maxFailures   int
+	cooldown      time.Duration
+	onStateChange func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func New(opts ...Option) *Breaker {
+	//nolint:exhaustruct // Runtime state starts zeroed
+	b := &Breaker{
+		maxFailures: _defaultMaxFailures,
+		cooldown:    _defaultCooldown,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Do calls fn unless the breaker is open, in which case it returns ErrOpen.
+// Context cancellations are not counted as failures of the dependency.
+func (b *Breaker) Do(fn func() error) error {
+	allowed, change := b.allow()
+	b.notify(change)
+	if !allowed {
+		return ErrOpen
+	}
+
+	err := fn()
+	b.notify(b.record(err == nil || errors.Is(err, context.Canceled)))
+
+	return err
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// transition is a state change reported to onStateChange once the breaker is unlocked.
+type transition struct {
+	from, to State
+}
+
+func (b *Breaker) allow() (bool, *transition) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		return true, nil
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, nil
+		}
+		b.trial = true
+		return true, b.setState(StateHalfOpen)
+	case StateHalfOpen:
+		// Only one trial call at a time while half-open.
+		if b.trial {
+			return false, nil
+		}
+		b.trial = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (b *Breaker) record(success bool) *transition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.trial = false
+	}
+
+	if success {
+		b.failures = 0
+		if b.state != StateClosed {
+			return b.setState(StateClosed)
+		}
+		return nil
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.maxFailures {
+		b.openedAt = time.Now()
+		if b.state != StateOpen {
+			return b.setState(StateOpen)
+		}
+	}
+
+	return nil
+}
+
+func (b *Breaker) setState(state State) *transition {
+	from := b.state
+	b.state = state
+
+	return &transition{from: from, to: state}
+}
+
+// notify calls onStateChange outside the lock, so the callback may use the breaker.
+func (b *Breaker) notify(change *transition) {
+	if change != nil && b.onStateChange != nil {
+		b.onStateChange(change.from, change.to)
+	}
+}
@@ -0,0 +1,147 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/pkg/circuitbreaker"
+)
+
+const _testCooldown = 20 * time.Millisecond
+
+var errDependency = errors.New("dependency failed")
+
+type step struct {
+	// wait lets the cooldown pass before the call.
+	wait bool
+	// result is what the dependency returns if it is called.
+	result error
+	// want is what Do returns, ErrOpen when the dependency must not be called.
+	want  error
+	state circuitbreaker.State
+}
+
+func TestBreakerStates(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after max failures",
+			steps: []step{
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateOpen},
+				{want: circuitbreaker.ErrOpen, state: circuitbreaker.StateOpen},
+			},
+		},
+		{
+			name: "success resets failures",
+			steps: []step{
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+				{state: circuitbreaker.StateClosed},
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+			},
+		},
+		{
+			name: "cancellations are not failures",
+			steps: []step{
+				{result: context.Canceled, want: context.Canceled, state: circuitbreaker.StateClosed},
+				{result: context.Canceled, want: context.Canceled, state: circuitbreaker.StateClosed},
+				{result: context.Canceled, want: context.Canceled, state: circuitbreaker.StateClosed},
+			},
+		},
+		{
+			name: "successful trial closes",
+			steps: []step{
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateOpen},
+				{wait: true, state: circuitbreaker.StateClosed},
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+			},
+		},
+		{
+			name: "failed trial reopens",
+			steps: []step{
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateClosed},
+				{result: errDependency, want: errDependency, state: circuitbreaker.StateOpen},
+				{wait: true, result: errDependency, want: errDependency, state: circuitbreaker.StateOpen},
+				{want: circuitbreaker.ErrOpen, state: circuitbreaker.StateOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := circuitbreaker.New(circuitbreaker.MaxFailures(2), circuitbreaker.Cooldown(_testCooldown))
+
+			for i, s := range tt.steps {
+				if s.wait {
+					time.Sleep(_testCooldown)
+				}
+
+				called := false
+				err := b.Do(func() error {
+					called = true
+					return s.result
+				})
+
+				if !errors.Is(err, s.want) {
+					t.Errorf("step %d: Do error = %v, want %v", i, err, s.want)
+				}
+				if wantCalled := !errors.Is(s.want, circuitbreaker.ErrOpen); called != wantCalled {
+					t.Errorf("step %d: dependency called = %t, want %t", i, called, wantCalled)
+				}
+				if got := b.State(); got != s.state {
+					t.Errorf("step %d: state = %s, want %s", i, got, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerAllowsOneTrialAtATime(t *testing.T) {
+	b := circuitbreaker.New(circuitbreaker.MaxFailures(1), circuitbreaker.Cooldown(_testCooldown))
+
+	_ = b.Do(func() error { return errDependency })
+	time.Sleep(_testCooldown)
+
+	err := b.Do(func() error {
+		if err := b.Do(func() error { return nil }); !errors.Is(err, circuitbreaker.ErrOpen) {
+			t.Errorf("concurrent Do error = %v, want %v", err, circuitbreaker.ErrOpen)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("trial Do error = %v, want none", err)
+	}
+}
+
+func TestBreakerReportsStateChanges(t *testing.T) {
+	var (
+		b       *circuitbreaker.Breaker
+		changes []string
+	)
+	b = circuitbreaker.New(
+		circuitbreaker.MaxFailures(1),
+		circuitbreaker.Cooldown(_testCooldown),
+		circuitbreaker.OnStateChange(func(from, to circuitbreaker.State) {
+			// The callback may use the breaker it is called by.
+			if state := b.State(); state != to {
+				t.Errorf("State() in callback = %s, want %s", state, to)
+			}
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+
+	_ = b.Do(func() error { return errDependency })
+	time.Sleep(_testCooldown)
+	_ = b.Do(func() error { return nil })
+
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if !slices.Equal(changes, want) {
+		t.Errorf("state changes = %v, want %v", changes, want)
+	}
+}
@@ -0,0 +1,23 @@
+package circuitbreaker
+
+import "time"
+
+type Option func(*Breaker)
+
+func MaxFailures(failures int) Option {
+	return func(b *Breaker) {
+		b.maxFailures = failures
+	}
+}
+
+func Cooldown(cooldown time.Duration) Option {
+	return func(b *Breaker) {
+		b.cooldown = cooldown
+	}
+}
+
+func OnStateChange(fn func(from, to State)) Option {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
@@ -0,0 +1,284 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	_defaultRefreshInterval    = time.Hour
+	_defaultMinRefreshInterval = 30 * time.Second
+	_defaultTimeout            = 10 * time.Second
+	_maxBodySize               = 1 << 20
+)
+
+var ErrKeyNotFound = errors.New("jwks: key not found")
+
+// Key is a public key from a key set.
+type Key struct {
+	// Algorithm is the "alg" of the key. It is empty when the key set does not pin one.
+	Algorithm string
+	Public    crypto.PublicKey
+}
+
+// Set is a JSON Web Key Set (RFC 7517) loaded from a file or an http(s) URL and cached in memory.
+type Set struct {
+	source             string
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	cacheFile          string
+	client             *http.Client
+
+	// refreshes lets concurrent callers share one read of the source, done without holding mu.
+	refreshes   singleflight.Group
+	mu          sync.Mutex
+	keys        map[string]Key
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// New returns a key set read from source, a file path or an http(s) URL. Keys are loaded on first use.
+func New(source string, opts ...Option) *Set {
+	//nolint:exhaustruct // Keys are loaded on first use
+	s := &Set{
+		source:             source,
+		refreshInterval:    _defaultRefreshInterval,
+		minRefreshInterval: _defaultMinRefreshInterval,
+		client:             &http.Client{Timeout: _defaultTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Key returns the key with the given ID. The set is refreshed when it is older than the refresh
+// interval, or early when the ID is unknown, since the provider may have rotated its keys.
+func (s *Set) Key(ctx context.Context, kid string) (Key, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	fresh := time.Since(s.fetchedAt) < s.refreshInterval
+	s.mu.Unlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	// The refresh is detached from the caller that started it, so its cancellation does not fail
+	// the callers waiting on it. The HTTP client timeout bounds it.
+	_, err, _ := s.refreshes.Do("", func() (interface{}, error) {
+		return nil, s.refresh(context.WithoutCancel(ctx))
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil && s.keys == nil {
+		return Key{}, err
+	}
+
+	key, ok = s.keys[kid]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	return key, nil
+}
+
+// refresh reloads the keys, at most once per minimum refresh interval. On failure the keys loaded
+// before are kept.
+func (s *Set) refresh(ctx context.Context) error {
+	s.mu.Lock()
+	if time.Since(s.attemptedAt) < s.minRefreshInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.attemptedAt = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := parse(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+	s.fetchedAt = time.Now()
+
+	return nil
+}
+
+func (s *Set) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		data, err := os.ReadFile(s.source)
+		if err != nil {
+			return nil, fmt.Errorf("jwks - read - os.ReadFile: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := s.fetch(ctx)
+	if err != nil {
+		if s.cacheFile == "" {
+			return nil, err
+		}
+
+		cached, cacheErr := os.ReadFile(s.cacheFile)
+		if cacheErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("jwks - read - os.ReadFile: %w", cacheErr))
+		}
+		return cached, nil
+	}
+
+	if s.cacheFile != "" {
+		// A failed write only costs the offline fallback.
+		_ = os.WriteFile(s.cacheFile, data, 0o600)
+	}
+
+	return data, nil
+}
+
+func (s *Set) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("jwks - fetch - http.NewRequestWithContext: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks - fetch - s.client.Do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks - fetch - unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, _maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("jwks - fetch - io.ReadAll: %w", err)
+	}
+
+	return data, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parse decodes a key set. Keys that are not signature keys or have an unsupported type are skipped.
+func parse(data []byte) (map[string]Key, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwks - parse - json.Unmarshal: %w", err)
+	}
+
+	keys := make(map[string]Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		public, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = Key{Algorithm: jwk.Alg, Public: public}
+	}
+
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,66 @@
+package jwks_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/realPointer/banners/pkg/jwks"
+)
+
+func TestKeyServesCachedKeysDuringRefresh(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	body := fmt.Sprintf(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"known","x":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(public))
+
+	var requests atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Every read after the first hangs until the test releases it.
+		if requests.Add(1) > 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx := context.Background()
+	set := jwks.New(server.URL, jwks.MinRefreshInterval(0))
+
+	if _, err := set.Key(ctx, "known"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	go func() {
+		_, _ = set.Key(ctx, "rotated")
+	}()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := set.Key(ctx, "known")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Key of a cached key during a refresh: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Key of a cached key waited for the refresh of an unknown one")
+	}
+}
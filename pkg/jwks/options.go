@@ -0,0 +1,36 @@
+package jwks
+
+import (
+	"net/http"
+	"time"
+)
+
+type Option func(*Set)
+
+// RefreshInterval is how long fetched keys are used before the source is read again.
+func RefreshInterval(interval time.Duration) Option {
+	return func(s *Set) {
+		s.refreshInterval = interval
+	}
+}
+
+// MinRefreshInterval limits how often an unknown key ID triggers an early refresh.
+func MinRefreshInterval(interval time.Duration) Option {
+	return func(s *Set) {
+		s.minRefreshInterval = interval
+	}
+}
+
+// CacheFile is where a key set fetched from a URL is saved. It is read instead when the URL
+// cannot be fetched, so tests and restarts work without reaching the identity provider.
+func CacheFile(path string) Option {
+	return func(s *Set) {
+		s.cacheFile = path
+	}
+}
+
+func HTTPClient(client *http.Client) Option {
+	return func(s *Set) {
+		s.client = client
+	}
+}
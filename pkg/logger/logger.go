@@ -1,21 +1,49 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/rs/zerolog"
 )
 
-func New(level string) (*zerolog.Logger, error) {
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// New creates a logger writing human-readable lines in the console format
+// or one JSON object per line in the JSON format.
+func New(level, format string) (*zerolog.Logger, error) {
 	l, err := zerolog.ParseLevel(level)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse log level: %w", err)
 	}
 
-	consoleWriter := zerolog.NewConsoleWriter()
-	logger := zerolog.New(consoleWriter).Level(l).
+	var logger zerolog.Logger
+	switch format {
+	case FormatConsole:
+		logger = zerolog.New(zerolog.NewConsoleWriter())
+	case FormatJSON:
+		logger = zerolog.New(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	logger = logger.Level(l).
 		With().Timestamp().CallerWithSkipFrameCount(zerolog.CallerSkipFrameCount).
 		Logger()
 
 	return &logger, nil
 }
+
+// FromContext returns the logger attached to ctx, such as the request logger with the request ID,
+// or fallback when ctx has none.
+func FromContext(ctx context.Context, fallback *zerolog.Logger) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+
+	return fallback
+}
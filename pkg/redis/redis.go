@@ -20,15 +20,13 @@ func New(url string, opts ...Option) (*Redis, error) {
 	rdb := &Redis{
 		Client: redis.NewClient(opt),
 	}
+	rdb.Client.AddHook(newTracingHook())
 
 	for _, opt := range opts {
 		opt(rdb)
 	}
 
-	if err := rdb.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("redis - New - rdb.Ping: %w", err)
-	}
-
+	// The client connects lazily, so New succeeds even while Redis is down. Use Ping to check it.
 	return rdb, nil
 }
 
@@ -0,0 +1,29 @@
+package tracing
+
+type Option func(*Tracing)
+
+func ServiceName(name string) Option {
+	return func(t *Tracing) {
+		t.serviceName = name
+	}
+}
+
+func ServiceVersion(version string) Option {
+	return func(t *Tracing) {
+		t.serviceVersion = version
+	}
+}
+
+// Endpoint is the host:port of the OTLP/HTTP collector.
+func Endpoint(endpoint string) Option {
+	return func(t *Tracing) {
+		t.endpoint = endpoint
+	}
+}
+
+// SampleRatio is the share of new traces that are recorded. Traces started upstream keep their decision.
+func SampleRatio(ratio float64) Option {
+	return func(t *Tracing) {
+		t.sampleRatio = ratio
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+
+	_defaultEndpoint    = "localhost:4318"
+	_defaultSampleRatio = 1
+)
+
+// Tracing installs the global OpenTelemetry tracer provider and the W3C trace context propagator.
+type Tracing struct {
+	serviceName    string
+	serviceVersion string
+	endpoint       string
+	sampleRatio    float64
+
+	provider *sdktrace.TracerProvider
+}
+
+// New sets up tracing with the given exporter. With ExporterNone spans are still created
+// and propagated, but never exported.
+func New(exporter string, opts ...Option) (*Tracing, error) {
+	//nolint:exhaustruct // The provider is created below
+	t := &Tracing{
+		endpoint:    _defaultEndpoint,
+		sampleRatio: _defaultSampleRatio,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(t.serviceName),
+		semconv.ServiceVersion(t.serviceVersion),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing - New - resource.Merge: %w", err)
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(t.sampleRatio))),
+	}
+
+	switch exporter {
+	case ExporterNone:
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("tracing - New - stdouttrace.New: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exp))
+	case ExporterOTLP:
+		exp, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpoint(t.endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tracing - New - otlptracehttp.New: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exp))
+	default:
+		return nil, fmt.Errorf("tracing - New - unknown exporter %q", exporter)
+	}
+
+	t.provider = sdktrace.NewTracerProvider(providerOpts...)
+
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return t, nil
+}
+
+// Shutdown flushes the spans that have not been exported yet.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	err := t.provider.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("tracing - Shutdown - t.provider.Shutdown: %w", err)
+	}
+
+	return nil
+}